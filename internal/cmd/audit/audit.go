@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var (
+		since   string
+		until   string
+		tool    string
+		outcome string
+		client  string
+		limit   int
+		format  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query the MCP audit log",
+		Long: `Query the audit log of MCP tool calls recorded in .dkit/audit.jsonl.
+
+Every tool call made through 'dkit mcp' is recorded with its client, tool
+name, masked arguments, outcome, result summary and duration.
+
+Examples:
+  dkit audit --since 1h
+  dkit audit --tool process_kill --outcome denied
+  dkit audit --since 2026-01-01T00:00:00Z --until 2026-01-02T00:00:00Z --format json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			now := time.Now()
+
+			var sinceTime, untilTime time.Time
+			var err error
+			if since != "" {
+				sinceTime, err = parseTimeFlag(since, now)
+				if err != nil {
+					utils.PrintError("Invalid --since: %v", err)
+					os.Exit(2)
+				}
+			}
+			if until != "" {
+				untilTime, err = parseTimeFlag(until, now)
+				if err != nil {
+					utils.PrintError("Invalid --until: %v", err)
+					os.Exit(2)
+				}
+			}
+
+			switch outcome {
+			case "", string(utils.AuditSuccess), string(utils.AuditError), string(utils.AuditDenied):
+			default:
+				utils.PrintError("Invalid --outcome: %s (use success|error|denied)", outcome)
+				os.Exit(2)
+			}
+			if format != "text" && format != "json" {
+				utils.PrintError("Invalid --format: %s (use text|json)", format)
+				os.Exit(2)
+			}
+
+			if tool != "" {
+				if _, err := filepath.Match(tool, ""); err != nil {
+					utils.PrintError("Invalid --tool pattern: %v", err)
+					os.Exit(2)
+				}
+			}
+
+			records, err := utils.LoadAuditRecords("")
+			if err != nil {
+				utils.PrintError("Failed to read audit log: %v", err)
+				return err
+			}
+
+			filtered := []utils.AuditRecord{}
+			for _, r := range records {
+				if !sinceTime.IsZero() && r.Timestamp.Before(sinceTime) {
+					continue
+				}
+				if !untilTime.IsZero() && !r.Timestamp.Before(untilTime) {
+					continue
+				}
+				if tool != "" {
+					if ok, _ := filepath.Match(tool, r.Tool); !ok {
+						continue
+					}
+				}
+				if outcome != "" && string(r.Outcome) != outcome {
+					continue
+				}
+				if client != "" && (r.Client == nil || !strings.EqualFold(r.Client.Name, client)) {
+					continue
+				}
+				filtered = append(filtered, r)
+			}
+
+			// Keep the most recent entries
+			if limit > 0 && len(filtered) > limit {
+				filtered = filtered[len(filtered)-limit:]
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(filtered)
+			}
+
+			return outputText(filtered)
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "Only show calls at or after this time (RFC 3339 or duration ago, e.g. 1h, 2d)")
+	cmd.Flags().StringVar(&until, "until", "", "Only show calls before this time (RFC 3339 or duration ago)")
+	cmd.Flags().StringVar(&tool, "tool", "", "Only show calls to this tool (glob patterns allowed, e.g. 'process_*')")
+	cmd.Flags().StringVar(&outcome, "outcome", "", "Only show calls with this outcome (success|error|denied)")
+	cmd.Flags().StringVar(&client, "client", "", "Only show calls from this MCP client")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "Show at most this many of the most recent calls")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format (text|json)")
+
+	return cmd
+}
+
+// parseTimeFlag parses an absolute time or a duration before now.
+// Durations accept whole days, e.g. "2d".
+func parseTimeFlag(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n) * 24 * time.Hour), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a time or duration", s)
+}
+
+// outputText prints one line per audit record
+func outputText(records []utils.AuditRecord) error {
+	if len(records) == 0 {
+		utils.PrintInfo("No audit records found")
+		return nil
+	}
+
+	for _, r := range records {
+		client := "-"
+		if r.Client != nil {
+			client = r.Client.Name
+		}
+
+		fmt.Printf("%s  %-7s  %-20s  %6dms  %s\n",
+			r.Timestamp.Local().Format("2006-01-02 15:04:05"), r.Outcome, r.Tool, r.DurationMs, client)
+
+		if len(r.Arguments) > 0 {
+			data, _ := json.Marshal(r.Arguments)
+			fmt.Printf("    args:   %s\n", data)
+		}
+		if r.Error != "" {
+			fmt.Printf("    error:  %s\n", r.Error)
+		} else if r.Result != "" {
+			fmt.Printf("    result: %s\n", r.Result)
+		}
+	}
+
+	return nil
+}
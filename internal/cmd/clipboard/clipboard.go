@@ -92,7 +92,7 @@ func newCopyCommand() *cobra.Command {
 				if appendFlag {
 					msg = fmt.Sprintf("Appended to clipboard (%d bytes total)", size)
 				}
-				utils.PrintSuccess(msg)
+				utils.PrintSuccess("%s", msg)
 			}
 
 			return nil
@@ -171,7 +171,7 @@ func newPasteCommand() *cobra.Command {
 					return fmt.Errorf("failed to write to file: %w", err)
 				}
 
-				utils.PrintSuccess(fmt.Sprintf("Clipboard content saved to %s (%d bytes)", output, len(outputContent)))
+				utils.PrintSuccess("Clipboard content saved to %s (%d bytes)", output, len(outputContent))
 			} else {
 				fmt.Print(outputContent)
 				if format == "text" && !strings.HasSuffix(outputContent, "\n") {
@@ -245,7 +245,7 @@ func newWatchCommand() *cobra.Command {
 				}
 				defer f.Close()
 				logWriter = f
-				utils.PrintInfo(fmt.Sprintf("Logging to %s", logFile))
+				utils.PrintInfo("Logging to %s", logFile)
 			}
 
 			for range ticker.C {
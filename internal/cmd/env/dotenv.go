@@ -0,0 +1,289 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Values accepted by dkit env set --quote
+const (
+	quoteAlways = "always"
+	quoteAuto   = "auto"
+	quoteNever  = "never"
+)
+
+// unquotedValuePattern matches values that are safe to write without quotes
+var unquotedValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=~-]+$`)
+
+// dotenvFile is a .env file parsed line by line. It keeps the original
+// lines so that variables can be located and edited without reformatting
+// the rest of the file. Values are read the way godotenv reads them.
+type dotenvFile struct {
+	lines   []string
+	entries []dotenvEntry
+
+	crlf       bool // lines end with \r\n
+	noFinalEOL bool // the last line has no line ending
+}
+
+// dotenvEntry is a variable assignment in a .env file
+type dotenvEntry struct {
+	key     string
+	value   string
+	line    int  // first line, 1-based
+	endLine int  // last line; quoted values may span lines
+	export  bool // written as "export KEY=value"
+	quote   byte // quote character of the value, or 0
+	comment string
+}
+
+// readDotenvFile parses a .env file
+func readDotenvFile(path string) (*dotenvFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDotenv(string(data)), nil
+}
+
+// parseDotenv parses .env content. Lines that are not assignments are kept
+// as they are.
+func parseDotenv(content string) *dotenvFile {
+	f := &dotenvFile{crlf: strings.Contains(content, "\r\n")}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if content != "" {
+		f.noFinalEOL = !strings.HasSuffix(content, "\n")
+		f.lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	for i := 0; i < len(f.lines); i++ {
+		line := strings.TrimSpace(f.lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := dotenvEntry{line: i + 1, endLine: i + 1}
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			entry.export = true
+			line = strings.TrimSpace(rest)
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 {
+			continue
+		}
+		entry.key = strings.TrimSpace(line[:sep])
+		if !isDotenvKey(entry.key) {
+			continue
+		}
+		raw := strings.TrimLeft(line[sep+1:], " \t")
+
+		if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+			entry.quote = raw[0]
+			value, rest, end := readQuoted(f.lines, i, raw)
+			entry.value = value
+			entry.endLine = end + 1
+			entry.comment = inlineComment(rest)
+			i = end
+		} else {
+			entry.value, entry.comment = splitInlineComment(raw)
+		}
+
+		f.entries = append(f.entries, entry)
+	}
+
+	return f
+}
+
+// readQuoted reads a quoted value starting at raw, which is part of line
+// i, and may continue on the following lines. It returns the value, the
+// text after the closing quote and the last line used. Like godotenv, an
+// escaped quote does not end the value and only double-quoted values
+// have escapes.
+func readQuoted(lines []string, i int, raw string) (string, string, int) {
+	quote := raw[0]
+	text := raw[1:]
+	var value strings.Builder
+
+	for {
+		for j := 0; j < len(text); j++ {
+			c := text[j]
+			switch {
+			case c == quote:
+				return value.String(), text[j+1:], i
+			case c == '\\' && j+1 < len(text) && quote == '\'':
+				// \' does not end a single-quoted value but is kept as is
+				value.WriteByte(c)
+				if text[j+1] == quote {
+					j++
+					value.WriteByte(quote)
+				}
+			case c == '\\' && j+1 < len(text):
+				j++
+				switch text[j] {
+				case 'n':
+					value.WriteByte('\n')
+				case 'r':
+					value.WriteByte('\r')
+				default:
+					value.WriteByte(text[j])
+				}
+			default:
+				value.WriteByte(c)
+			}
+		}
+
+		if i+1 >= len(lines) {
+			return value.String(), "", i
+		}
+		value.WriteByte('\n')
+		i++
+		text = lines[i]
+	}
+}
+
+// splitInlineComment splits an unquoted value from a trailing
+// " # comment". As in godotenv, the last such "#" starts the comment.
+func splitInlineComment(raw string) (string, string) {
+	for i := len(raw) - 1; i > 0; i-- {
+		if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+			return strings.TrimSpace(raw[:i]), strings.TrimSpace(raw[i+1:])
+		}
+	}
+	return strings.TrimSpace(raw), ""
+}
+
+// inlineComment returns the comment after a quoted value
+func inlineComment(rest string) string {
+	rest = strings.TrimSpace(rest)
+	if comment, ok := strings.CutPrefix(rest, "#"); ok {
+		return strings.TrimSpace(comment)
+	}
+	return ""
+}
+
+func isDotenvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || c == '.' || c == '-' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the last assignment of key, which is the one that counts
+func (f *dotenvFile) lookup(key string) (dotenvEntry, bool) {
+	for i := len(f.entries) - 1; i >= 0; i-- {
+		if f.entries[i].key == key {
+			return f.entries[i], true
+		}
+	}
+	return dotenvEntry{}, false
+}
+
+// set assigns a value to key. The last assignment of key is rewritten in
+// place, keeping its export prefix, indentation and inline comment unless
+// a new comment is given; a new key is appended. Everything else in the
+// file stays as it is.
+func (f *dotenvFile) set(key, value, quote, comment string) error {
+	formatted, err := formatDotenvValue(value, quote)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(comment, "\r\n") {
+		return fmt.Errorf("comment must be a single line")
+	}
+
+	entry, exists := f.lookup(key)
+	if exists && comment == "" {
+		comment = entry.comment
+	}
+
+	line := key + "=" + formatted
+	if comment != "" {
+		line += " # " + comment
+	}
+
+	if !exists {
+		f.lines = append(f.lines, line)
+		f.noFinalEOL = false
+		return nil
+	}
+
+	original := f.lines[entry.line-1]
+	indent := original[:len(original)-len(strings.TrimLeft(original, " \t"))]
+	if entry.export {
+		line = "export " + line
+	}
+
+	lines := append([]string{}, f.lines[:entry.line-1]...)
+	lines = append(lines, indent+line)
+	lines = append(lines, f.lines[entry.endLine:]...)
+	crlf, noFinalEOL := f.crlf, f.noFinalEOL
+	*f = *parseDotenv(strings.Join(lines, "\n"))
+	f.crlf, f.noFinalEOL = crlf, noFinalEOL
+	return nil
+}
+
+// formatDotenvValue quotes a value so that godotenv reads it back
+// unchanged. auto leaves simple values unquoted and prefers single quotes,
+// which need no escapes; values with line breaks use double quotes.
+func formatDotenvValue(value, quote string) (string, error) {
+	multiline := strings.ContainsAny(value, "\r\n")
+
+	switch quote {
+	case quoteNever:
+		if multiline || strings.TrimSpace(value) != value ||
+			strings.HasPrefix(value, "'") || strings.HasPrefix(value, "\"") ||
+			strings.Contains(value, " #") || strings.Contains(value, "\t#") || strings.Contains(value, "$") {
+			return "", fmt.Errorf("value cannot be written without quotes; use --quote auto")
+		}
+		return value, nil
+
+	case quoteAuto:
+		if value == "" || unquotedValuePattern.MatchString(value) {
+			return value, nil
+		}
+		fallthrough
+
+	case quoteAlways:
+		// godotenv keeps single-quoted values literally, but cannot end
+		// them with a backslash before the closing quote
+		if !multiline && !strings.Contains(value, "'") && !strings.HasSuffix(value, "\\") {
+			return "'" + value + "'", nil
+		}
+		if strings.HasSuffix(value, "\\") {
+			return "", fmt.Errorf("value ending with a backslash cannot be quoted safely")
+		}
+		// $ would expand variables inside double quotes
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`).Replace(value)
+		return `"` + escaped + `"`, nil
+	}
+
+	return "", fmt.Errorf("invalid quote mode: %s (use always|auto|never)", quote)
+}
+
+// eol returns the line ending of the file
+func (f *dotenvFile) eol() string {
+	if f.crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// String returns the file content with its original line endings
+func (f *dotenvFile) String() string {
+	if len(f.lines) == 0 {
+		return ""
+	}
+	content := strings.Join(f.lines, f.eol())
+	if !f.noFinalEOL {
+		content += f.eol()
+	}
+	return content
+}
@@ -233,106 +233,51 @@ func newMergeCommand() *cobra.Command {
 }
 
 func newValidateCommand() *cobra.Command {
-	var (
-		required     string
-		requiredFile string
-		schema       string
-		allowEmpty   bool
-		strict       bool
-	)
+	var opts validateOptions
 
 	cmd := &cobra.Command{
 		Use:   "validate [file...]",
 		Short: "Check environment configuration",
-		Long:  `Validate environment files against a schema or required variables list.`,
+		Long: `Validate environment files against a schema or required variables list.
+
+A schema (YAML, or JSON with comments) describes each variable:
+
+  variables:
+    DATABASE_URL:
+      type: url              # string, int, bool, url, email, port, duration or enum
+      required: true
+      description: Postgres connection string
+    WORKERS:
+      type: int
+      min: 1
+      max: 64
+    LOG_LEVEL:
+      type: enum
+      values: [debug, info, warn, error]
+      default: info
+    API_KEY:
+      pattern: ^sk_[a-z0-9]+$
+      min: 20                # length for strings
+    SENTRY_DSN:
+      type: url
+      required_if:
+        APP_ENV: [production, staging]
+
+Every violation is reported with the file and line of the assignment, or
+the schema line of a missing variable. Variables that the schema does not
+define are warnings; --strict turns warnings into errors. Exits with 2 if
+validation fails.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			envVars, _, err := loadEnvFiles(args, true)
-			if err != nil {
-				return err
-			}
-
-			hasErrors := false
-
-			// Get required variables list
-			var requiredVars []string
-			if required != "" {
-				requiredVars = strings.Split(required, ",")
-				for i := range requiredVars {
-					requiredVars[i] = strings.TrimSpace(requiredVars[i])
-				}
-			}
-
-			if requiredFile != "" {
-				data, err := os.ReadFile(requiredFile)
-				if err != nil {
-					utils.PrintError("Failed to read required-file: %v", err)
-					os.Exit(1)
-				}
-				lines := strings.Split(string(data), "\n")
-				for _, line := range lines {
-					line = strings.TrimSpace(line)
-					if line != "" && !strings.HasPrefix(line, "#") {
-						requiredVars = append(requiredVars, line)
-					}
-				}
-			}
-
-			// Check required variables
-			var missingVars []string
-			var emptyVars []string
-
-			for _, varName := range requiredVars {
-				value, exists := envVars[varName]
-				if !exists {
-					missingVars = append(missingVars, varName)
-					hasErrors = true
-				} else if value == "" && !allowEmpty {
-					emptyVars = append(emptyVars, varName)
-					if strict {
-						hasErrors = true
-					}
-				}
-			}
-
-			// Print results
-			if len(missingVars) > 0 {
-				utils.PrintError("Missing required variables:")
-				for _, varName := range missingVars {
-					fmt.Fprintf(os.Stderr, "  - %s\n", varName)
-				}
-			}
-
-			if len(emptyVars) > 0 {
-				if strict {
-					utils.PrintError("Empty values for required variables:")
-				} else {
-					utils.PrintWarning("Empty values for required variables:")
-				}
-				for _, varName := range emptyVars {
-					fmt.Fprintf(os.Stderr, "  - %s\n", varName)
-				}
-			}
-
-			if hasErrors {
-				utils.PrintError("Validation failed")
-				os.Exit(2)
-			}
-
-			utils.PrintSuccess("Validation passed")
-			utils.PrintInfo("Found %d variables", len(envVars))
-			if len(requiredVars) > 0 {
-				utils.PrintInfo("All %d required variables present", len(requiredVars))
-			}
-
-			return nil
+			return runValidate(args, opts)
 		},
 	}
 
-	cmd.Flags().StringVar(&required, "required", "", "Comma-separated list of required variables")
-	cmd.Flags().StringVar(&requiredFile, "required-file", "", "File containing required variables")
-	cmd.Flags().StringVar(&schema, "schema", "", "JSON schema file for validation")
-	cmd.Flags().BoolVar(&allowEmpty, "allow-empty", false, "Allow empty values for required variables")
-	cmd.Flags().BoolVar(&strict, "strict", false, "Fail on warnings")
+	cmd.Flags().StringVar(&opts.required, "required", "", "Comma-separated list of required variables")
+	cmd.Flags().StringVar(&opts.requiredFile, "required-file", "", "File containing required variables")
+	cmd.Flags().StringVar(&opts.schema, "schema", "", "Schema file (YAML or JSONC) describing the variables")
+	cmd.Flags().BoolVar(&opts.allowEmpty, "allow-empty", false, "Allow empty values for required variables")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Fail on warnings")
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Output format (text|json)")
 
 	return cmd
 }
@@ -395,38 +340,47 @@ func newSetCommand() *cobra.Command {
 			varName := args[0]
 			varValue := args[1]
 
+			if quote != quoteAlways && quote != quoteAuto && quote != quoteNever {
+				utils.PrintError("Invalid quote mode: %s (use always|auto|never)", quote)
+				os.Exit(2)
+			}
+			if !isDotenvKey(varName) {
+				utils.PrintError("Invalid variable name: %s", varName)
+				os.Exit(2)
+			}
+
 			// Check if file exists
-			_, err := os.Stat(file)
+			info, err := os.Stat(file)
+			mode := os.FileMode(0600)
 			if os.IsNotExist(err) {
 				if !create {
 					utils.PrintError("File not found: %s", file)
 					utils.PrintInfo("Use --create flag to create the file")
 					os.Exit(1)
 				}
-				// Create empty file with secure permissions
-				f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0600)
-				if err != nil {
-					utils.PrintError("Failed to create file: %v", err)
-					os.Exit(1)
-				}
-				f.Close()
 			} else if err != nil {
 				utils.PrintError("Failed to access file: %v", err)
 				os.Exit(1)
+			} else {
+				mode = info.Mode().Perm()
 			}
 
-			// Load existing variables
-			envVars, err := godotenv.Read(file)
-			if err != nil {
-				envVars = make(map[string]string)
+			// Load the file as is, so that only the variable's line changes
+			env := &dotenvFile{}
+			if info != nil {
+				if env, err = readDotenvFile(file); err != nil {
+					utils.PrintError("Failed to read file: %v", err)
+					os.Exit(1)
+				}
 			}
 
-			// Update the variable
-			envVars[varName] = varValue
+			if err := env.set(varName, varValue, quote, comment); err != nil {
+				utils.PrintError("Cannot set %s: %v", varName, err)
+				os.Exit(2)
+			}
 
-			// Write back to file
-			err = godotenv.Write(envVars, file)
-			if err != nil {
+			// Write back to file, with secure permissions for new files
+			if err := os.WriteFile(file, []byte(env.String()), mode); err != nil {
 				utils.PrintError("Failed to write to file: %v", err)
 				os.Exit(1)
 			}
@@ -438,8 +392,8 @@ func newSetCommand() *cobra.Command {
 
 	cmd.Flags().StringVar(&file, "file", ".env", "Environment file to modify")
 	cmd.Flags().BoolVar(&create, "create", false, "Create file if it doesn't exist")
-	cmd.Flags().StringVar(&quote, "quote", "auto", "Quote behavior (always|auto|never)")
-	cmd.Flags().StringVar(&comment, "comment", "", "Add inline comment")
+	cmd.Flags().StringVar(&quote, "quote", quoteAuto, "Quote behavior (always|auto|never)")
+	cmd.Flags().StringVar(&comment, "comment", "", "Add inline comment (replaces an existing one)")
 
 	return cmd
 }
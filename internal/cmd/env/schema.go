@@ -0,0 +1,348 @@
+package env
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
+)
+
+// Variable types supported in schemas
+var schemaTypes = []string{"string", "int", "bool", "url", "email", "port", "duration", "enum"}
+
+// envSchema describes the variables of an environment. It is read from
+// YAML, or from JSON with comments and trailing commas (JSONC):
+//
+//	variables:
+//	  DATABASE_URL:
+//	    type: url
+//	    required: true
+//	    description: Postgres connection string
+//	  LOG_LEVEL:
+//	    type: enum
+//	    values: [debug, info, warn, error]
+//	    default: info
+//	  SENTRY_DSN:
+//	    type: url
+//	    required_if:
+//	      APP_ENV: [production, staging]
+type envSchema struct {
+	path      string
+	Variables map[string]*schemaVariable `yaml:"variables"`
+}
+
+// schemaVariable holds the rules for a single variable. Min and Max bound
+// the value of int, port and duration variables and the length of the
+// others.
+type schemaVariable struct {
+	Type        string                  `yaml:"type"`
+	Description string                  `yaml:"description"`
+	Required    bool                    `yaml:"required"`
+	RequiredIf  map[string]schemaValues `yaml:"required_if"`
+	Default     *string                 `yaml:"default"`
+	Pattern     string                  `yaml:"pattern"`
+	Min         *string                 `yaml:"min"`
+	Max         *string                 `yaml:"max"`
+	Values      []string                `yaml:"values"`
+
+	name    string
+	line    int // line of the definition in the schema file
+	pattern *regexp.Regexp
+	min     *float64
+	max     *float64
+}
+
+// schemaValues is a value or a list of values
+type schemaValues []string
+
+func (v *schemaValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = schemaValues{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*v = values
+	return nil
+}
+
+// loadSchema reads a schema file. Files ending in .json or .jsonc are read
+// as JSONC, everything else as YAML.
+func loadSchema(path string) (*envSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, so both go through the YAML decoder. Standardize
+	// replaces comments with whitespace, which keeps line numbers intact.
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonc":
+		if data, err = hujson.Standardize(data); err != nil {
+			return nil, fmt.Errorf("invalid JSONC in %s: %w", path, err)
+		}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	schema := &envSchema{path: path}
+	if err := root.Decode(schema); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if schema.Variables == nil {
+		return nil, fmt.Errorf("%s: no variables defined", path)
+	}
+
+	lines := variableLines(&root)
+	for name, v := range schema.Variables {
+		if v == nil {
+			v = &schemaVariable{}
+			schema.Variables[name] = v
+		}
+		v.name = name
+		v.line = lines[name]
+		if err := v.compile(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %w", path, v.line, name, err)
+		}
+	}
+
+	return schema, nil
+}
+
+// variableLines returns the line of each variable definition
+func variableLines(root *yaml.Node) map[string]int {
+	lines := map[string]int{}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return lines
+	}
+
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "variables" {
+			continue
+		}
+		vars := doc.Content[i+1]
+		for j := 0; j+1 < len(vars.Content); j += 2 {
+			lines[vars.Content[j].Value] = vars.Content[j].Line
+		}
+	}
+	return lines
+}
+
+// compile checks the rules and prepares them for validation
+func (v *schemaVariable) compile() error {
+	if v.Type == "" {
+		v.Type = "string"
+	}
+	if !slices.Contains(schemaTypes, v.Type) {
+		return fmt.Errorf("unknown type %q (use %s)", v.Type, strings.Join(schemaTypes, "|"))
+	}
+
+	if v.Type == "enum" && len(v.Values) == 0 {
+		return fmt.Errorf("enum needs values")
+	}
+	if v.Type != "enum" && len(v.Values) > 0 {
+		return fmt.Errorf("values only apply to enum")
+	}
+
+	if v.Pattern != "" {
+		re, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		v.pattern = re
+	}
+
+	var err error
+	if v.min, err = v.parseBound("min", v.Min); err != nil {
+		return err
+	}
+	if v.max, err = v.parseBound("max", v.Max); err != nil {
+		return err
+	}
+	if v.min != nil && v.max != nil && *v.min > *v.max {
+		return fmt.Errorf("min is greater than max")
+	}
+
+	if v.Default != nil {
+		if problems := v.check(*v.Default); len(problems) > 0 {
+			return fmt.Errorf("invalid default: %s", problems[0].message)
+		}
+	}
+
+	return nil
+}
+
+func (v *schemaVariable) parseBound(name string, s *string) (*float64, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	var bound float64
+	switch v.Type {
+	case "bool", "enum":
+		return nil, fmt.Errorf("%s does not apply to %s", name, v.Type)
+	case "duration":
+		d, err := time.ParseDuration(*s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s is not a duration", name, *s)
+		}
+		bound = float64(d)
+	case "int", "port":
+		f, err := strconv.ParseFloat(*s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s is not a number", name, *s)
+		}
+		bound = f
+	default:
+		n, err := strconv.Atoi(*s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: %s is not a length", name, *s)
+		}
+		bound = float64(n)
+	}
+	return &bound, nil
+}
+
+// schemaProblem is a rule a value breaks
+type schemaProblem struct {
+	rule    string
+	message string
+}
+
+// check returns the rules the value breaks
+func (v *schemaVariable) check(value string) []schemaProblem {
+	problems := []schemaProblem{}
+	typeError := func(message string) []schemaProblem {
+		return append(problems, schemaProblem{"type", message})
+	}
+
+	// measured is what min and max are compared with
+	measured := float64(len([]rune(value)))
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	unit := " characters"
+
+	switch v.Type {
+	case "int":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return typeError("must be an integer")
+		}
+		measured, unit = float64(n), ""
+	case "bool":
+		if _, ok := parseBool(value); !ok {
+			return typeError("must be a boolean (true|false|1|0|yes|no|on|off)")
+		}
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || (u.Host == "" && !(u.Scheme == "file" && u.Path != "")) {
+			return typeError("must be a URL such as https://example.com/path")
+		}
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return typeError("must be an email address")
+		}
+	case "port":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 65535 {
+			return typeError("must be a port number (1-65535)")
+		}
+		measured, unit = float64(n), ""
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return typeError("must be a duration such as 30s or 5m")
+		}
+		measured, unit = float64(d), ""
+		format = func(f float64) string {
+			return time.Duration(f).String()
+		}
+	case "enum":
+		if !slices.Contains(v.Values, value) {
+			return typeError("must be one of " + strings.Join(v.Values, ", "))
+		}
+	}
+
+	if v.min != nil && measured < *v.min {
+		if unit != "" {
+			problems = append(problems, schemaProblem{"min", fmt.Sprintf("must be at least %s%s long", format(*v.min), unit)})
+		} else {
+			problems = append(problems, schemaProblem{"min", fmt.Sprintf("must be at least %s", format(*v.min))})
+		}
+	}
+	if v.max != nil && measured > *v.max {
+		if unit != "" {
+			problems = append(problems, schemaProblem{"max", fmt.Sprintf("must be at most %s%s long", format(*v.max), unit)})
+		} else {
+			problems = append(problems, schemaProblem{"max", fmt.Sprintf("must be at most %s", format(*v.max))})
+		}
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		problems = append(problems, schemaProblem{"pattern", fmt.Sprintf("must match %s", v.Pattern)})
+	}
+
+	return problems
+}
+
+// requiredBy returns the required_if condition that holds, if any. Every
+// variable in the condition must have one of its listed values.
+func (v *schemaVariable) requiredBy(envVars map[string]string) (string, bool) {
+	if len(v.RequiredIf) == 0 {
+		return "", false
+	}
+
+	names := make([]string, 0, len(v.RequiredIf))
+	for name := range v.RequiredIf {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{}
+	for _, name := range names {
+		values := v.RequiredIf[name]
+		if !slices.Contains(values, envVars[name]) {
+			return "", false
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", name, strings.Join(values, "|")))
+	}
+	return strings.Join(parts, ", "), true
+}
+
+// parseBool parses the boolean spellings accepted in .env files
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "1", "yes", "on":
+		return true, true
+	case "false", "0", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// sortedNames returns the variable names of the schema in order
+func (s *envSchema) sortedNames() []string {
+	names := make([]string, 0, len(s.Variables))
+	for name := range s.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,314 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// validateOptions holds the flags of dkit env validate
+type validateOptions struct {
+	required     string
+	requiredFile string
+	schema       string
+	allowEmpty   bool
+	strict       bool
+	format       string
+}
+
+// Violation severities
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// violation is a problem found by dkit env validate. File and Line point
+// at the assignment, or at the schema definition of a missing variable.
+type violation struct {
+	Variable string `json:"variable"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// validationReport is the JSON output of dkit env validate
+type validationReport struct {
+	Valid      bool        `json:"valid"`
+	Files      []string    `json:"files"`
+	Schema     string      `json:"schema,omitempty"`
+	Variables  int         `json:"variables"`
+	Required   int         `json:"required"`
+	Errors     int         `json:"errors"`
+	Warnings   int         `json:"warnings"`
+	Violations []violation `json:"violations"`
+}
+
+func runValidate(files []string, opts validateOptions) error {
+	if opts.format != "text" && opts.format != "json" {
+		utils.PrintError("Invalid format: %s (use text|json)", opts.format)
+		os.Exit(2)
+	}
+	if len(files) == 0 {
+		files = []string{".env"}
+	}
+
+	envVars, sources, err := loadEnvFiles(files, true)
+	if err != nil {
+		return err
+	}
+
+	var schema *envSchema
+	if opts.schema != "" {
+		schema, err = loadSchema(opts.schema)
+		if err != nil {
+			utils.PrintError("Invalid schema: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// Get required variables list
+	var requiredVars []string
+	if opts.required != "" {
+		for _, name := range strings.Split(opts.required, ",") {
+			requiredVars = append(requiredVars, strings.TrimSpace(name))
+		}
+	}
+	if opts.requiredFile != "" {
+		data, err := os.ReadFile(opts.requiredFile)
+		if err != nil {
+			utils.PrintError("Failed to read required-file: %v", err)
+			os.Exit(1)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				requiredVars = append(requiredVars, line)
+			}
+		}
+	}
+
+	v := &validator{
+		opts:       opts,
+		envVars:    envVars,
+		sources:    sources,
+		parsed:     map[string]*dotenvFile{},
+		reported:   map[string]bool{},
+		violations: []violation{},
+	}
+	for _, name := range requiredVars {
+		v.checkRequired(name, "", 0, "")
+	}
+	if schema != nil {
+		v.checkSchema(schema)
+	}
+
+	// Report in file order
+	sort.SliceStable(v.violations, func(i, j int) bool {
+		a, b := v.violations[i], v.violations[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	report := validationReport{
+		Valid:      true,
+		Files:      files,
+		Variables:  len(envVars),
+		Required:   len(requiredVars),
+		Violations: v.violations,
+	}
+	if schema != nil {
+		report.Schema = schema.path
+	}
+	for _, viol := range v.violations {
+		if viol.Severity == severityError {
+			report.Errors++
+			report.Valid = false
+		} else {
+			report.Warnings++
+		}
+	}
+
+	if opts.format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printViolations(report)
+	}
+
+	if !report.Valid {
+		os.Exit(2)
+	}
+	return nil
+}
+
+// validator collects violations
+type validator struct {
+	opts       validateOptions
+	envVars    map[string]string
+	sources    map[string]string
+	parsed     map[string]*dotenvFile
+	reported   map[string]bool // required variables already reported
+	violations []violation
+}
+
+// add records a violation at the assignment of the variable, or at
+// file:line if the variable is not set
+func (v *validator) add(name, rule, severity, message, file string, line int) {
+	if source, ok := v.sources[name]; ok {
+		file, line = source, v.lineOf(source, name)
+	}
+	v.violations = append(v.violations, violation{
+		Variable: name,
+		File:     file,
+		Line:     line,
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// lineOf returns the line that assigns the variable in a file, or 0
+func (v *validator) lineOf(file, name string) int {
+	f, ok := v.parsed[file]
+	if !ok {
+		f, _ = readDotenvFile(file)
+		v.parsed[file] = f
+	}
+	if f == nil {
+		return 0
+	}
+	if entry, ok := f.lookup(name); ok {
+		return entry.line
+	}
+	return 0
+}
+
+// checkRequired reports a missing or empty required variable and returns
+// whether it is set. because explains why it is required.
+func (v *validator) checkRequired(name, file string, line int, because string) bool {
+	value, exists := v.envVars[name]
+	ok := exists && (value != "" || v.opts.allowEmpty)
+	if ok || v.reported[name] {
+		return ok
+	}
+	v.reported[name] = true
+
+	if !exists {
+		v.add(name, "required", severityError, fmt.Sprintf("%s is required%s but not set", name, because), file, line)
+		return false
+	}
+
+	severity := severityWarning
+	if v.opts.strict {
+		severity = severityError
+	}
+	v.add(name, "empty", severity, fmt.Sprintf("%s is required%s but empty", name, because), file, line)
+	return false
+}
+
+// checkSchema checks every variable against the schema. Variables the
+// schema does not know are warnings, or errors with --strict.
+func (v *validator) checkSchema(schema *envSchema) {
+	for _, name := range schema.sortedNames() {
+		rule := schema.Variables[name]
+		value, exists := v.envVars[name]
+
+		// A default stands in for a missing variable
+		if !exists && rule.Default != nil {
+			continue
+		}
+
+		required := rule.Required
+		because := ""
+		if condition, ok := rule.requiredBy(v.envVars); ok {
+			required = true
+			because = " when " + condition
+		}
+		if required && !v.checkRequired(name, schema.path, rule.line, because) {
+			continue
+		}
+		if !exists || value == "" {
+			continue
+		}
+
+		for _, problem := range rule.check(value) {
+			v.add(name, problem.rule, severityError, fmt.Sprintf("%s %s", name, problem.message), "", 0)
+		}
+	}
+
+	severity := severityWarning
+	if v.opts.strict {
+		severity = severityError
+	}
+	for _, name := range getSortedKeys(v.envVars) {
+		if _, ok := schema.Variables[name]; !ok {
+			v.add(name, "unknown", severity, fmt.Sprintf("%s is not defined in the schema", name), "", 0)
+		}
+	}
+}
+
+// printViolations prints the result for humans
+func printViolations(report validationReport) {
+	location := func(viol violation) string {
+		switch {
+		case viol.File != "" && viol.Line > 0:
+			return fmt.Sprintf("%s:%d: ", viol.File, viol.Line)
+		case viol.File != "":
+			return viol.File + ": "
+		}
+		return ""
+	}
+
+	for _, severity := range []string{severityError, severityWarning} {
+		var lines []string
+		for _, viol := range report.Violations {
+			if viol.Severity == severity {
+				lines = append(lines, location(viol)+viol.Message)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		if severity == severityError {
+			utils.PrintError("%d %s:", len(lines), plural(len(lines), "error", "errors"))
+		} else {
+			utils.PrintWarning("%d %s:", len(lines), plural(len(lines), "warning", "warnings"))
+		}
+		for _, line := range lines {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
+		}
+	}
+
+	if !report.Valid {
+		utils.PrintError("Validation failed")
+		return
+	}
+
+	utils.PrintSuccess("Validation passed")
+	utils.PrintInfo("Found %d variables", report.Variables)
+	if report.Required > 0 {
+		utils.PrintInfo("All %d required variables present", report.Required)
+	}
+	if report.Schema != "" {
+		utils.PrintInfo("Checked against %s", report.Schema)
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,161 @@
+package logs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/delinoio/dkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var (
+		stream    string
+		lines     int
+		startLine int
+		maxTokens int
+		maxBytes  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs <process-id>",
+		Short: "Show the logs of a process started by dkit run",
+		Long: `Show the stdout and stderr logs of a process started by dkit run.
+
+With --max-tokens or --max-bytes, the whole log is shortened to fit the
+budget: the start, the end and the lines around errors are kept, and
+markers show which lines were omitted and how to print them.
+
+Examples:
+  dkit logs 1718000000000000000
+  dkit logs 1718000000000000000 --stream stderr --max-tokens 2000
+  dkit logs 1718000000000000000 --start-line 120 --lines 40`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			processID := args[0]
+
+			if stream != "stdout" && stream != "stderr" && stream != "both" {
+				utils.PrintError("Invalid stream: %s (use stdout|stderr|both)", stream)
+				os.Exit(2)
+			}
+			if startLine < 0 || lines < 0 || maxTokens < 0 || maxBytes < 0 {
+				utils.PrintError("--start-line, --lines, --max-tokens and --max-bytes must not be negative")
+				os.Exit(2)
+			}
+
+			if _, err := utils.LoadProcessMetadata("", processID); err != nil {
+				utils.PrintError("Process not found: %s", processID)
+				return err
+			}
+
+			dataDir, err := utils.GetDkitDataDir("")
+			if err != nil {
+				return err
+			}
+
+			budget := maxBytes
+			if budget == 0 {
+				budget = maxTokens * utils.BytesPerToken
+			}
+
+			streams := []string{stream}
+			if stream == "both" {
+				streams = []string{"stdout", "stderr"}
+			}
+
+			// Select the requested window of each stream first, so the budget
+			// can be split by size
+			windows := make([][]string, len(streams))
+			firstLines := make([]int, len(streams))
+			sizes := make([]int, len(streams))
+			for i, name := range streams {
+				logLines, err := readLogLines(filepath.Join(dataDir, "processes", processID, name+".log"))
+				if err != nil {
+					utils.PrintError("Failed to read %s: %v", name, err)
+					return err
+				}
+
+				from, to := 0, len(logLines)
+				if startLine > 0 {
+					from = min(startLine-1, len(logLines))
+					if lines > 0 {
+						to = min(from+lines, len(logLines))
+					}
+				} else if lines > 0 && lines < len(logLines) {
+					from = len(logLines) - lines
+				}
+
+				windows[i] = logLines[from:to]
+				firstLines[i] = from + 1
+				for _, line := range windows[i] {
+					sizes[i] += len(line) + 1
+				}
+			}
+
+			budgets := utils.SplitExcerptBudget(sizes, budget)
+			for i, name := range streams {
+				excerpt := utils.BuildExcerpt(windows[i], utils.ExcerptOptions{
+					MaxBytes:  budgets[i],
+					FirstLine: firstLines[i],
+					Marker: func(first, last int) string {
+						return fmt.Sprintf("[dkit] ... %d lines omitted (lines %d-%d); show them with: dkit logs %s --stream %s --start-line %d --lines %d",
+							last-first+1, first, last, processID, name, first, last-first+1)
+					},
+				})
+
+				if len(streams) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("==> %s <==\n", name)
+				}
+				if len(excerpt.Lines) > 0 {
+					fmt.Println(strings.Join(excerpt.Lines, "\n"))
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&stream, "stream", "both", "Which stream to show (stdout|stderr|both)")
+	cmd.Flags().IntVarP(&lines, "lines", "n", 0, "Number of lines to show, from the end or from --start-line (default: all)")
+	cmd.Flags().IntVar(&startLine, "start-line", 0, "Show lines starting at this 1-based line number")
+	cmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Shorten the log to about this many tokens")
+	cmd.Flags().IntVar(&maxBytes, "max-bytes", 0, "Shorten the log to at most this many bytes")
+
+	return cmd
+}
+
+// readLogLines reads a log file as lines. A missing log is empty.
+func readLogLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(line, "\n")
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+const (
+	// maskedValue replaces secrets in audited arguments
+	maskedValue = "***"
+
+	// maxAuditSummaryLength bounds the result summary stored per call
+	maxAuditSummaryLength = 200
+)
+
+var (
+	// secretKeyPattern matches argument names whose values are secrets
+	secretKeyPattern = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|credential|api_?key|private_?key|auth)`)
+
+	// secretAssignmentPattern matches NAME=value pairs with a secret name,
+	// e.g. in command lines or --set arguments
+	secretAssignmentPattern = regexp.MustCompile(`(?i)\b([A-Z0-9_.-]*(?:secret|token|passw(?:or)?d|credential|api_?key|private_?key|auth)[A-Z0-9_.-]*)=("[^"]*"|'[^']*'|\S+)`)
+
+	// secretPositionalPattern matches a secret variable name followed by its
+	// value, e.g. "dkit env set DB_PASSWORD hunter2". Only upper-case names
+	// are matched so that prose such as "token is required" is kept.
+	secretPositionalPattern = regexp.MustCompile(`\b([A-Z0-9_]*(?:SECRET|TOKEN|PASSW(?:OR)?D|CREDENTIAL|API_?KEY|PRIVATE_?KEY|AUTH)[A-Z0-9_]*)(\s+)("[^"]*"|'[^']*'|[^\s"']+)`)
+
+	// bearerPattern matches HTTP bearer credentials
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+
+	// sensitiveArguments are never written to the audit log, whatever their
+	// content, because they carry free-form input
+	sensitiveArguments = map[string][]string{
+		"process_send_input": {"text"},
+	}
+)
+
+// auditToolCall appends a record of a tool call to .dkit/audit.jsonl.
+// Failing to audit never fails the call itself.
+func auditToolCall(name string, args map[string]interface{}, result interface{}, err error, started time.Time) {
+	record := utils.AuditRecord{
+		Timestamp:  started,
+		Tool:       name,
+		Arguments:  maskToolArguments(name, args),
+		Outcome:    utils.AuditSuccess,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+
+	session.Lock()
+	if session.client.Name != "" {
+		record.Client = &utils.AuditClient{
+			Name:    session.client.Name,
+			Version: session.client.Version,
+		}
+	}
+	session.Unlock()
+
+	switch {
+	case asPolicyDenial(err) != nil:
+		record.Outcome = utils.AuditDenied
+		record.Error = maskSecrets(err.Error())
+	case err != nil:
+		record.Outcome = utils.AuditError
+		record.Error = maskSecrets(err.Error())
+	default:
+		if f, ok := result.(interface{ failed() bool }); ok && f.failed() {
+			record.Outcome = utils.AuditError
+		}
+		record.Result = summarizeResult(result)
+	}
+
+	projectRoot := ""
+	if dkitDir, err := getDkitDir(); err == nil {
+		projectRoot = filepath.Dir(dkitDir)
+	}
+
+	if err := utils.AppendAuditRecord(projectRoot, record); err != nil {
+		fmt.Fprintf(os.Stderr, "[dkit] WARNING: %v\n", err)
+	}
+}
+
+// summarizeResult produces a short, masked description of a tool result.
+// The output of command tools is left out, since commands such as env get
+// print secrets.
+func summarizeResult(result interface{}) string {
+	if r, ok := result.(*commandResult); ok {
+		command := r.Command
+		if r.argv != nil {
+			command = "dkit " + strings.Join(maskArgList(r.argv), " ")
+		}
+		return fmt.Sprintf("%s exited with code %d", maskSecrets(command), r.ExitCode)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return ""
+	}
+
+	summary := maskSecrets(string(data))
+	if len(summary) > maxAuditSummaryLength {
+		summary = summary[:maxAuditSummaryLength] + "..."
+	}
+	return summary
+}
+
+// maskToolArguments masks the arguments of a call to the named tool
+func maskToolArguments(name string, args map[string]interface{}) map[string]interface{} {
+	masked := maskArguments(args)
+	for _, key := range sensitiveArguments[name] {
+		if _, ok := masked[key]; ok {
+			masked[key] = maskedValue
+		}
+	}
+	return masked
+}
+
+// maskArguments returns a copy of args with secret values masked
+func maskArguments(args map[string]interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+
+	masked := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if secretKeyPattern.MatchString(k) {
+			masked[k] = maskedValue
+			continue
+		}
+		masked[k] = maskValue(v)
+	}
+	return masked
+}
+
+// maskValue masks secrets inside nested argument values
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return maskSecrets(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = maskValue(item)
+		}
+		// A secret may follow its flag or variable name as a separate argument
+		for i := 1; i < len(items); i++ {
+			if name, ok := items[i-1].(string); ok && isSecretName(name) {
+				items[i] = maskedValue
+			}
+		}
+		return items
+	case map[string]interface{}:
+		return maskArguments(v)
+	default:
+		return v
+	}
+}
+
+// maskArgList masks a command line: NAME=value secrets, and the argument
+// following a secret flag or variable name
+func maskArgList(argv []string) []string {
+	masked := make([]string, len(argv))
+	for i, arg := range argv {
+		if i > 0 && isSecretName(argv[i-1]) {
+			masked[i] = maskedValue
+			continue
+		}
+		masked[i] = maskSecrets(arg)
+	}
+	return masked
+}
+
+// isSecretName reports whether an argument names a secret whose value is
+// the next argument, e.g. "--api-key" or "DB_PASSWORD"
+func isSecretName(arg string) bool {
+	return arg != "" && arg != "--" && !strings.ContainsAny(arg, "= ") && secretKeyPattern.MatchString(arg)
+}
+
+// maskSecrets masks NAME=value and NAME value secrets and bearer
+// credentials in text
+func maskSecrets(s string) string {
+	s = secretAssignmentPattern.ReplaceAllString(s, "${1}="+maskedValue)
+	s = secretPositionalPattern.ReplaceAllString(s, "${1}${2}"+maskedValue)
+	return bearerPattern.ReplaceAllString(s, "${1} "+maskedValue)
+}
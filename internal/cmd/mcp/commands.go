@@ -0,0 +1,338 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// commandToolPrefix prefixes tools generated from CLI commands
+	commandToolPrefix = "dkit_"
+
+	// commandToolTimeout bounds how long a generated command tool may run
+	commandToolTimeout = 60 * time.Second
+)
+
+// defaultDeniedCommands are hidden from agents unless explicitly allowed in
+// .dkit/mcp.json. They either never terminate, need a terminal, reveal
+// secrets, are destructive without a confirmation prompt, or duplicate a
+// built-in tool.
+var defaultDeniedCommands = []string{
+	"clipboard",
+	"env get",
+	"env list",
+	"env merge",
+	"env set",
+	"git resolve-conflict",
+	"logs",
+	"port kill",
+	"port watch",
+	"retry",
+	"run",
+}
+
+// commandTool is an MCP tool generated from a cobra command
+type commandTool struct {
+	tool    tool
+	path    []string
+	command *cobra.Command
+}
+
+// commandTools holds the generated tools, in registration order
+var commandTools []*commandTool
+
+// registerCommandTools walks the cobra command tree and generates a tool for
+// every runnable command permitted by the project configuration
+func registerCommandTools(root *cobra.Command) error {
+	config, err := loadMCPConfig()
+	if err != nil {
+		return err
+	}
+
+	commandTools = nil
+	walkCommands(root, nil, func(c *cobra.Command, path []string) {
+		commandPath := strings.Join(path, " ")
+
+		// The MCP server itself is never exposed
+		if path[0] == "mcp" {
+			return
+		}
+		if len(config.Commands.Allow) > 0 && !matchesCommandPath(commandPath, config.Commands.Allow) {
+			return
+		}
+		if matchesCommandPath(commandPath, config.Commands.Deny) {
+			return
+		}
+		if matchesCommandPath(commandPath, defaultDeniedCommands) && !matchesCommandPath(commandPath, config.Commands.Allow) {
+			return
+		}
+
+		commandTools = append(commandTools, &commandTool{
+			tool:    buildCommandTool(c, path),
+			path:    path,
+			command: c,
+		})
+	})
+
+	return nil
+}
+
+// walkCommands calls fn for every visible, runnable command below c
+func walkCommands(c *cobra.Command, path []string, fn func(*cobra.Command, []string)) {
+	for _, child := range c.Commands() {
+		if child.Hidden || child.Name() == "help" {
+			continue
+		}
+
+		childPath := append(append([]string{}, path...), child.Name())
+		if child.Runnable() {
+			fn(child, childPath)
+		}
+		walkCommands(child, childPath, fn)
+	}
+}
+
+// findCommandTool returns the generated tool with the given name
+func findCommandTool(name string) *commandTool {
+	for _, ct := range commandTools {
+		if ct.tool.Name == name {
+			return ct
+		}
+	}
+	return nil
+}
+
+// buildCommandTool produces the tool definition and JSON Schema for a command
+func buildCommandTool(c *cobra.Command, path []string) tool {
+	properties := map[string]interface{}{}
+
+	c.NonInheritedFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Hidden {
+			return
+		}
+		properties[f.Name] = flagSchema(f)
+	})
+
+	required := []string{}
+	usage := strings.TrimSpace(strings.TrimPrefix(c.Use, c.Name()))
+	if usage != "" {
+		properties["args"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Positional arguments: " + usage,
+		}
+		if strings.Contains(usage, "<") {
+			required = append(required, "args")
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	description := c.Short
+	if description == "" {
+		description = c.Long
+	}
+
+	return tool{
+		Name:        commandToolPrefix + strings.ReplaceAll(strings.Join(path, "_"), "-", "_"),
+		Description: fmt.Sprintf("%s (runs `dkit %s`)", description, strings.Join(path, " ")),
+		InputSchema: schema,
+	}
+}
+
+// flagSchema maps a pflag type to a JSON Schema property
+func flagSchema(f *pflag.Flag) map[string]interface{} {
+	prop := map[string]interface{}{
+		"description": f.Usage,
+	}
+
+	switch f.Value.Type() {
+	case "bool":
+		prop["type"] = "boolean"
+		if v, err := strconv.ParseBool(f.DefValue); err == nil {
+			prop["default"] = v
+		}
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "count":
+		prop["type"] = "integer"
+		if v, err := strconv.ParseInt(f.DefValue, 10, 64); err == nil {
+			prop["default"] = v
+		}
+	case "float32", "float64":
+		prop["type"] = "number"
+		if v, err := strconv.ParseFloat(f.DefValue, 64); err == nil {
+			prop["default"] = v
+		}
+	case "stringSlice", "stringArray":
+		prop["type"] = "array"
+		prop["items"] = map[string]interface{}{"type": "string"}
+	case "intSlice", "int32Slice", "int64Slice", "uintSlice":
+		prop["type"] = "array"
+		prop["items"] = map[string]interface{}{"type": "integer"}
+	case "duration":
+		prop["type"] = "string"
+		prop["description"] = f.Usage + " (duration, e.g. 30s)"
+		prop["default"] = f.DefValue
+	default:
+		prop["type"] = "string"
+		if f.DefValue != "" {
+			prop["default"] = f.DefValue
+		}
+	}
+
+	return prop
+}
+
+// buildCommandArgs converts tool arguments into a command line
+func buildCommandArgs(ct *commandTool, args map[string]interface{}) ([]string, error) {
+	argv := append([]string{}, ct.path...)
+	var positional []string
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := args[name]
+		if name == "args" {
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("args must be an array of strings")
+			}
+			for _, item := range items {
+				positional = append(positional, formatArgValue(item))
+			}
+			continue
+		}
+
+		flag := ct.command.NonInheritedFlags().Lookup(name)
+		if flag == nil || flag.Name == "help" || flag.Hidden {
+			return nil, fmt.Errorf("unknown argument: %s", name)
+		}
+
+		if items, ok := value.([]interface{}); ok {
+			for _, item := range items {
+				argv = append(argv, fmt.Sprintf("--%s=%s", name, formatArgValue(item)))
+			}
+			continue
+		}
+		argv = append(argv, fmt.Sprintf("--%s=%s", name, formatArgValue(value)))
+	}
+
+	if len(positional) > 0 {
+		argv = append(argv, "--")
+		argv = append(argv, positional...)
+	}
+
+	return argv, nil
+}
+
+// formatArgValue formats a JSON value as a command-line argument
+func formatArgValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// commandResult is the captured output of a generated command tool
+type commandResult struct {
+	Command  string      `json:"command"`
+	ExitCode int         `json:"exit_code"`
+	Stdout   string      `json:"stdout"`
+	Stderr   string      `json:"stderr"`
+	Output   interface{} `json:"output,omitempty"`
+
+	argv []string // arguments after "dkit", for audit masking
+}
+
+// failed marks the tool result as an error when the command exits non-zero
+func (r *commandResult) failed() bool {
+	return r.ExitCode != 0
+}
+
+// handleCommandTool runs a generated command tool as a subprocess of the
+// dkit executable and captures its output. The subprocess has its own
+// stdin, stdout and stderr, so an exit or a hung command cannot affect the
+// MCP server.
+func handleCommandTool(ctx context.Context, ct *commandTool, args map[string]interface{}) (interface{}, error) {
+	argv, err := buildCommandArgs(ct, args)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate dkit executable: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandToolTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, argv...)
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for children that inherited the output pipes once the
+	// command itself was killed
+	cmd.WaitDelay = time.Second
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command timed out after %s", commandToolTimeout)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("failed to run command: %w", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	result := &commandResult{
+		Command:  "dkit " + strings.Join(argv, " "),
+		ExitCode: exitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		argv:     argv,
+	}
+
+	// Expose JSON output (e.g. --format json) as structured data
+	var parsed interface{}
+	if json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &parsed) == nil {
+		result.Output = parsed
+	}
+
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// mcpConfig is the project configuration read from .dkit/mcp.json.
+// The file may contain comments and trailing commas (JSONC).
+type mcpConfig struct {
+	Commands commandsConfig `json:"commands"`
+}
+
+// commandsConfig controls which CLI commands are exposed as MCP tools.
+// Entries are command paths without the "dkit" prefix, e.g. "env list" or
+// "port" (which matches every port subcommand).
+type commandsConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// loadMCPConfig loads .dkit/mcp.json, returning an empty config if the
+// project has no .dkit directory or no config file
+func loadMCPConfig() (*mcpConfig, error) {
+	config := &mcpConfig{}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return config, nil
+	}
+
+	configPath := filepath.Join(dkitDir, "mcp.json")
+	if err := readJSONCFile(configPath, config); err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// readJSONCFile parses a JSONC file into v
+func readJSONCFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	standard, err := hujson.Standardize(data)
+	if err != nil {
+		return fmt.Errorf("invalid JSONC in %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(standard, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// matchesCommandPath reports whether a command path is covered by any entry
+func matchesCommandPath(path string, entries []string) bool {
+	for _, entry := range entries {
+		entry = strings.Join(strings.Fields(entry), " ")
+		if entry == "" {
+			continue
+		}
+		if path == entry || strings.HasPrefix(path, entry+" ") {
+			return true
+		}
+	}
+	return false
+}
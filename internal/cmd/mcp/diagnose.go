@@ -0,0 +1,590 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxDiagnoseLines bounds how many lines of each log are parsed. Longer
+	// logs are parsed from the end.
+	maxDiagnoseLines = 100000
+
+	// maxExcerptLines bounds the raw excerpt attached to a diagnostic
+	maxExcerptLines = 20
+)
+
+// diagnostic is a compiler, linter or runtime error found in a log
+type diagnostic struct {
+	Severity string `json:"severity"` // error, warning, info
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Stream   string `json:"stream"`
+	LogLine  int    `json:"log_line"`
+	Excerpt  string `json:"excerpt"`
+}
+
+// diagnosticMatcher recognizes the diagnostics of one tool. match is called
+// for each log line; it returns nil if no diagnostic starts at lines[i], or
+// the diagnostic and the number of log lines it spans.
+type diagnosticMatcher struct {
+	source string
+	match  func(lines []string, i int) (*diagnostic, int)
+}
+
+// diagnosticMatchers are tried in order on every log line
+var diagnosticMatchers = []diagnosticMatcher{
+	{"go", matchGoPanic},
+	{"go", matchGo},
+	{"tsc", matchTSC},
+	{"eslint", matchESLintStylish},
+	{"eslint", matchESLintCompact},
+	{"rust", matchRust},
+	{"python", matchPythonTraceback},
+	{"gcc", matchGCC},
+	{"gcc", matchLinker},
+}
+
+var severityRank = map[string]int{
+	"error":   0,
+	"warning": 1,
+	"info":    2,
+}
+
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+func handleProcessDiagnose(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	processID, ok := args["process_id"].(string)
+	if !ok || processID == "" {
+		return nil, fmt.Errorf("process_id is required")
+	}
+
+	streams := []string{"stderr", "stdout"}
+	if s, ok := args["stream"].(string); ok && s != "both" {
+		if s != "stdout" && s != "stderr" {
+			return nil, fmt.Errorf("invalid stream: %s", s)
+		}
+		streams = []string{s}
+	}
+
+	minSeverity := "info"
+	if s, ok := args["min_severity"].(string); ok {
+		if _, ok := severityRank[s]; !ok {
+			return nil, fmt.Errorf("invalid min_severity: %s", s)
+		}
+		minSeverity = s
+	}
+
+	limit := 50
+	if m, ok := args["max_diagnostics"].(float64); ok && m > 0 {
+		limit = int(m)
+	}
+
+	if _, err := loadProcessMetadata(processID); err != nil {
+		return nil, err
+	}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := []diagnostic{}
+	seen := map[string]bool{}
+	for _, stream := range streams {
+		lines, offset, err := readDiagnoseLines(ctx, filepath.Join(dkitDir, "processes", processID, stream+".log"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stream, err)
+		}
+
+		for _, d := range extractDiagnostics(lines) {
+			if severityRank[d.Severity] > severityRank[minSeverity] {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d:%d:%s", d.File, d.Line, d.Column, d.Message)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			d.Stream = stream
+			d.LogLine += offset
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	// Errors first, then in order of appearance
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return severityRank[diagnostics[i].Severity] < severityRank[diagnostics[j].Severity]
+	})
+
+	counts := map[string]int{}
+	for _, d := range diagnostics {
+		counts[d.Severity]++
+	}
+
+	total := len(diagnostics)
+	truncated := false
+	if total > limit {
+		diagnostics = diagnostics[:limit]
+		truncated = true
+	}
+
+	return map[string]interface{}{
+		"process_id":  processID,
+		"diagnostics": diagnostics,
+		"total":       total,
+		"counts":      counts,
+		"truncated":   truncated,
+	}, nil
+}
+
+// readDiagnoseLines reads a log with ANSI escapes removed, keeping at most
+// maxDiagnoseLines from the end. It also returns the number of lines skipped.
+func readDiagnoseLines(ctx context.Context, path string) ([]string, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	lines := []string{}
+	offset := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		lines = append(lines, ansiEscapePattern.ReplaceAllString(line, ""))
+		if len(lines) > 2*maxDiagnoseLines {
+			offset += len(lines) - maxDiagnoseLines
+			lines = append(lines[:0], lines[len(lines)-maxDiagnoseLines:]...)
+		}
+	}
+
+	if len(lines) > maxDiagnoseLines {
+		offset += len(lines) - maxDiagnoseLines
+		lines = lines[len(lines)-maxDiagnoseLines:]
+	}
+
+	return lines, offset, nil
+}
+
+// extractDiagnostics runs the matchers over a log. LogLine is 1-based.
+func extractDiagnostics(lines []string) []diagnostic {
+	diagnostics := []diagnostic{}
+
+	for i := 0; i < len(lines); {
+		consumed := 1
+		for _, m := range diagnosticMatchers {
+			d, n := m.match(lines, i)
+			if d == nil {
+				continue
+			}
+			d.Source = m.source
+			d.LogLine = i + 1
+			if d.Excerpt == "" {
+				d.Excerpt = excerpt(lines, i, n)
+			}
+			diagnostics = append(diagnostics, *d)
+			if n > 1 {
+				consumed = n
+			}
+			break
+		}
+		i += consumed
+	}
+
+	return diagnostics
+}
+
+// excerpt joins n lines starting at i, capped at maxExcerptLines
+func excerpt(lines []string, i, n int) string {
+	if n < 1 {
+		n = 1
+	}
+	if n > maxExcerptLines {
+		n = maxExcerptLines
+	}
+	if i+n > len(lines) {
+		n = len(lines) - i
+	}
+	return strings.Join(lines[i:i+n], "\n")
+}
+
+// continuationLines counts the lines after i accepted by fn, up to max
+func continuationLines(lines []string, i, max int, fn func(string) bool) int {
+	n := 0
+	for j := i + 1; j < len(lines) && n < max; j++ {
+		if !fn(lines[j]) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// Go
+
+var (
+	goLocationPattern = regexp.MustCompile(`^(\s*)(?:vet: )?((?:[A-Za-z]:)?[^\s:()]+\.go):(\d+)(?::(\d+))?: (.+)$`)
+	goPanicPattern    = regexp.MustCompile(`^(panic|fatal error): (.+)$`)
+	goFramePattern    = regexp.MustCompile(`^\t(.+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// goRuntimeDirs are skipped when looking for the frame that caused a panic
+var goRuntimeDirs = []string{"/src/runtime/", "/src/testing/", "/src/reflect/", "/src/sync/", "/src/internal/"}
+
+// maxTestScanLines bounds how far inFailingTest looks for the test that a
+// line of go test output belongs to
+const maxTestScanLines = 1000
+
+// matchGo matches go build, go vet and go test failure locations. Indented
+// locations are written by t.Log and t.Error: they are errors in the output
+// of a failing test and notes everywhere else.
+func matchGo(lines []string, i int) (*diagnostic, int) {
+	m := goLocationPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	// Compiler errors may continue on tab-indented lines (have/want)
+	n := 1
+	if m[1] == "" {
+		n += continuationLines(lines, i, maxExcerptLines, func(l string) bool {
+			return strings.HasPrefix(l, "\t")
+		})
+	}
+
+	severity := "error"
+	if m[1] != "" && !inFailingTest(lines, i, len(m[1])) {
+		severity = "info"
+	}
+
+	return &diagnostic{
+		Severity: severity,
+		File:     m[2],
+		Line:     atoi(m[3]),
+		Column:   atoi(m[4]),
+		Message:  m[5],
+	}, n
+}
+
+// inFailingTest reports whether line i of go test output, indented by
+// indent, belongs to a failing test. Without -v the output of a test
+// follows its "--- FAIL" line; with -v it follows "=== RUN" and precedes the
+// test's result line.
+func inFailingTest(lines []string, i, indent int) bool {
+	header := ""
+	for j := i - 1; j >= 0 && j >= i-maxTestScanLines; j-- {
+		trimmed := strings.TrimLeft(lines[j], " \t")
+		if trimmed == "" || len(lines[j])-len(trimmed) >= indent {
+			continue
+		}
+		header = trimmed
+		break
+	}
+
+	if strings.HasPrefix(header, "--- FAIL") {
+		return true
+	}
+	fields := strings.Fields(header)
+	if !strings.HasPrefix(header, "=== ") || len(fields) < 3 {
+		return false
+	}
+
+	name := fields[2]
+	for j := i + 1; j < len(lines) && j <= i+maxTestScanLines; j++ {
+		fields := strings.Fields(lines[j])
+		if len(fields) >= 3 && strings.HasPrefix(fields[0], "---") && fields[2] == name {
+			return fields[1] == "FAIL:"
+		}
+	}
+	return false
+}
+
+// matchGoPanic matches panics and fatal runtime errors, locating them at
+// the first stack frame outside the Go runtime
+func matchGoPanic(lines []string, i int) (*diagnostic, int) {
+	m := goPanicPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	d := &diagnostic{
+		Severity: "error",
+		Message:  m[0],
+		Code:     strings.ReplaceAll(m[1], " ", "_"),
+	}
+
+	for j := i + 1; j < len(lines) && j < i+200; j++ {
+		f := goFramePattern.FindStringSubmatch(lines[j])
+		if f == nil || isGoRuntimeFrame(f[1]) {
+			continue
+		}
+		d.File = f[1]
+		d.Line = atoi(f[2])
+		return d, j - i + 1
+	}
+
+	return d, 1
+}
+
+func isGoRuntimeFrame(path string) bool {
+	for _, dir := range goRuntimeDirs {
+		if strings.Contains(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeScript
+
+var (
+	tscPattern       = regexp.MustCompile(`^(.+?\.(?:ts|tsx|mts|cts|js|jsx|mjs|cjs))\((\d+),(\d+)\): (error|warning) (TS\d+): (.+)$`)
+	tscPrettyPattern = regexp.MustCompile(`^(.+?\.(?:ts|tsx|mts|cts|js|jsx|mjs|cjs)):(\d+):(\d+) - (error|warning) (TS\d+): (.+)$`)
+)
+
+// matchTSC matches tsc output in both plain and --pretty formats
+func matchTSC(lines []string, i int) (*diagnostic, int) {
+	n := 1
+	m := tscPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		m = tscPrettyPattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			return nil, 0
+		}
+		// The pretty format is followed by a code frame up to a blank line
+		n += continuationLines(lines, i, maxExcerptLines, func(l string) bool {
+			return strings.TrimSpace(l) != ""
+		})
+	}
+
+	return &diagnostic{
+		Severity: m[4],
+		File:     m[1],
+		Line:     atoi(m[2]),
+		Column:   atoi(m[3]),
+		Message:  m[6],
+		Code:     m[5],
+	}, n
+}
+
+// ESLint
+
+var (
+	eslintEntryPattern   = regexp.MustCompile(`^\s+(\d+):(\d+)\s+(error|warning)\s+(.+?)(?:\s{2,}(\S+))?$`)
+	eslintFilePattern    = regexp.MustCompile(`^(\S.*\.(?:js|jsx|ts|tsx|mjs|cjs|mts|cts|vue|svelte|astro))$`)
+	eslintCompactPattern = regexp.MustCompile(`^(.+): line (\d+), col (\d+), (Error|Warning) - (.+?)(?: \(([^()]+)\))?$`)
+)
+
+// matchESLintStylish matches entries of the default formatter, which are
+// listed under a line naming the file
+func matchESLintStylish(lines []string, i int) (*diagnostic, int) {
+	m := eslintEntryPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	for j := i - 1; j >= 0; j-- {
+		if eslintEntryPattern.MatchString(lines[j]) {
+			continue
+		}
+		f := eslintFilePattern.FindStringSubmatch(lines[j])
+		if f == nil {
+			return nil, 0
+		}
+		return &diagnostic{
+			Severity: m[3],
+			File:     f[1],
+			Line:     atoi(m[1]),
+			Column:   atoi(m[2]),
+			Message:  m[4],
+			Code:     m[5],
+			Excerpt:  f[1] + "\n" + lines[i],
+		}, 1
+	}
+
+	return nil, 0
+}
+
+// matchESLintCompact matches the compact formatter
+func matchESLintCompact(lines []string, i int) (*diagnostic, int) {
+	m := eslintCompactPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	return &diagnostic{
+		Severity: strings.ToLower(m[4]),
+		File:     m[1],
+		Line:     atoi(m[2]),
+		Column:   atoi(m[3]),
+		Message:  m[5],
+		Code:     m[6],
+	}, 1
+}
+
+// Rust
+
+var (
+	rustHeaderPattern   = regexp.MustCompile(`^(error|warning)(?:\[([A-Za-z]+\d+|[a-z_:]+)\])?: (.+)$`)
+	rustLocationPattern = regexp.MustCompile(`^\s*--> (.+?):(\d+):(\d+)$`)
+)
+
+// matchRust matches rustc and clippy diagnostics. Summary lines such as
+// "error: could not compile" have neither a location nor a code and are
+// skipped.
+func matchRust(lines []string, i int) (*diagnostic, int) {
+	m := rustHeaderPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	d := &diagnostic{
+		Severity: m[1],
+		Message:  m[3],
+		Code:     m[2],
+	}
+
+	n := 1 + continuationLines(lines, i, 50, func(l string) bool {
+		return strings.TrimSpace(l) != "" && !rustHeaderPattern.MatchString(l)
+	})
+	for j := i + 1; j < i+n; j++ {
+		if loc := rustLocationPattern.FindStringSubmatch(lines[j]); loc != nil {
+			d.File = loc[1]
+			d.Line = atoi(loc[2])
+			d.Column = atoi(loc[3])
+			break
+		}
+	}
+
+	if d.File == "" && d.Code == "" {
+		return nil, 0
+	}
+	return d, n
+}
+
+// Python
+
+var (
+	pythonTracebackPattern = regexp.MustCompile(`^(\s*)Traceback \(most recent call last\):$`)
+	pythonFramePattern     = regexp.MustCompile(`^\s+File "(.+)", line (\d+)(?:, in .+)?$`)
+	pythonExceptionPattern = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*)(?::|$)`)
+)
+
+// matchPythonTraceback matches a traceback, located at its innermost frame
+// and described by the exception line that ends it
+func matchPythonTraceback(lines []string, i int) (*diagnostic, int) {
+	m := pythonTracebackPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+	indent := len(m[1])
+
+	d := &diagnostic{Severity: "error"}
+	for j := i + 1; j < len(lines) && j < i+500; j++ {
+		line := lines[j]
+		if f := pythonFramePattern.FindStringSubmatch(line); f != nil {
+			d.File = f[1]
+			d.Line = atoi(f[2])
+			continue
+		}
+		if strings.TrimSpace(line) == "" || len(line)-len(strings.TrimLeft(line, " \t")) > indent {
+			// Source lines and carets belonging to a frame
+			continue
+		}
+
+		d.Message = strings.TrimSpace(line)
+		if e := pythonExceptionPattern.FindStringSubmatch(line); e != nil {
+			d.Code = e[1]
+		}
+		n := j - i + 1
+		if n > maxExcerptLines {
+			// Keep the start and the innermost frames
+			d.Excerpt = strings.Join(lines[i:i+5], "\n") + "\n...\n" + strings.Join(lines[j-maxExcerptLines+6:j+1], "\n")
+		}
+		return d, n
+	}
+
+	return nil, 0
+}
+
+// GCC and Clang
+
+var (
+	gccPattern    = regexp.MustCompile(`^(.+?\.(?:c|cc|cpp|cxx|c\+\+|h|hh|hpp|hxx|m|mm|cu)):(\d+):(\d+): (fatal error|error|warning|note): (.+?)(?: \[(-W[^\]]+)\])?$`)
+	linkerPattern = regexp.MustCompile(`^(?:\S*/)?(?:ld|ld\.lld|ld\.gold|collect2|clang|gcc|g\+\+|cc)(?:\.exe)?: (?:error: )?(.*(?:undefined reference|undefined symbol|cannot find|ld returned|linker command failed).*)$`)
+)
+
+// matchGCC matches gcc and clang diagnostics with their code frames
+func matchGCC(lines []string, i int) (*diagnostic, int) {
+	m := gccPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	severity := "error"
+	switch m[4] {
+	case "warning":
+		severity = "warning"
+	case "note":
+		severity = "info"
+	}
+
+	n := 1 + continuationLines(lines, i, 5, func(l string) bool {
+		return strings.HasPrefix(l, " ")
+	})
+
+	return &diagnostic{
+		Severity: severity,
+		File:     m[1],
+		Line:     atoi(m[2]),
+		Column:   atoi(m[3]),
+		Message:  m[5],
+		Code:     m[6],
+	}, n
+}
+
+// matchLinker matches linker failures, which have no source location
+func matchLinker(lines []string, i int) (*diagnostic, int) {
+	m := linkerPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return nil, 0
+	}
+
+	return &diagnostic{
+		Severity: "error",
+		Message:  m[1],
+	}, 1
+}
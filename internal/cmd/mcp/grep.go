@@ -0,0 +1,293 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// grepMatch describes a single line matching a process_grep pattern
+type grepMatch struct {
+	ProcessID string   `json:"process_id"`
+	Stream    string   `json:"stream"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Timestamp string   `json:"timestamp,omitempty"`
+	Text      string   `json:"text"`
+	Before    []string `json:"before,omitempty"`
+	After     []string `json:"after,omitempty"`
+}
+
+// grepOptions controls how log files are searched
+type grepOptions struct {
+	Pattern      *regexp.Regexp
+	ContextLines int
+	MaxMatches   int
+}
+
+func handleProcessGrep(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+
+	caseSensitive := true
+	if c, ok := args["case_sensitive"].(bool); ok {
+		caseSensitive = c
+	}
+
+	expr := pattern
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	stream := "both"
+	if s, ok := args["stream"].(string); ok {
+		stream = s
+	}
+	if stream != "stdout" && stream != "stderr" && stream != "both" {
+		return nil, fmt.Errorf("invalid stream: %s (use stdout, stderr or both)", stream)
+	}
+
+	contextLines := 0
+	if c, ok := args["context"].(float64); ok && c > 0 {
+		contextLines = int(c)
+	}
+
+	maxMatches := 100
+	if m, ok := args["max_matches"].(float64); ok && m > 0 {
+		maxMatches = int(m)
+	}
+
+	// Determine which processes to search
+	var processIDs []string
+	if processID, ok := args["process_id"].(string); ok && processID != "" {
+		if _, err := loadProcessMetadata(processID); err != nil {
+			return nil, err
+		}
+		processIDs = []string{processID}
+	} else {
+		index, err := loadProcessIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		status := ""
+		if s, ok := args["status"].(string); ok {
+			status = s
+		}
+
+		for _, p := range filterProcesses(index.Processes, status, 0) {
+			processIDs = append(processIDs, p.ID)
+		}
+	}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return nil, err
+	}
+
+	streams := []string{"stdout", "stderr"}
+	if stream != "both" {
+		streams = []string{stream}
+	}
+
+	opts := grepOptions{
+		Pattern:      re,
+		ContextLines: contextLines,
+		MaxMatches:   maxMatches,
+	}
+
+	matches := []grepMatch{}
+	searched := 0
+	truncated := false
+
+	total := float64(len(processIDs) * len(streams))
+
+search:
+	for _, id := range processIDs {
+		for _, s := range streams {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if len(matches) >= opts.MaxMatches {
+				truncated = true
+				break search
+			}
+
+			logPath := filepath.Join(dkitDir, "processes", id, s+".log")
+			found, more, err := grepLogFile(ctx, logPath, opts, opts.MaxMatches-len(matches))
+			if err != nil {
+				return nil, fmt.Errorf("failed to search %s: %w", logPath, err)
+			}
+			searched++
+			reportProgress(ctx, float64(searched), total, fmt.Sprintf("Searched %s %s", id, s))
+
+			for i := range found {
+				found[i].ProcessID = id
+				found[i].Stream = s
+				found[i].File = filepath.ToSlash(filepath.Join(".dkit", "processes", id, s+".log"))
+			}
+			matches = append(matches, found...)
+
+			if more {
+				truncated = true
+				break search
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"pattern":        pattern,
+		"matches":        matches,
+		"total_matches":  len(matches),
+		"searched_files": searched,
+		"truncated":      truncated,
+	}, nil
+}
+
+// grepLogFile streams a log file line by line and returns up to limit matches.
+// The second return value reports whether more matches exist beyond the limit.
+func grepLogFile(ctx context.Context, logPath string, opts grepOptions, limit int) ([]grepMatch, bool, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	defer file.Close()
+
+	// Timestamps are recorded by dkit run in a sidecar file with one
+	// entry per log line; older processes may not have one.
+	var timestamps *bufio.Reader
+	tsPath := strings.TrimSuffix(logPath, ".log") + ".timestamps"
+	if tsFile, err := os.Open(tsPath); err == nil {
+		defer tsFile.Close()
+		timestamps = bufio.NewReader(tsFile)
+	}
+
+	reader := bufio.NewReader(file)
+	matches := []grepMatch{}
+	before := make([]string, 0, opts.ContextLines)
+	pending := []int{} // indexes of matches still collecting trailing context
+	lineNum := 0
+	more := false // a match beyond the limit was seen
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		lineNum++
+
+		timestamp := ""
+		if timestamps != nil {
+			if ts, err := readLine(timestamps); err == nil {
+				timestamp = ts
+			} else {
+				timestamps = nil
+			}
+		}
+
+		// Feed trailing context to earlier matches
+		stillPending := pending[:0]
+		for _, idx := range pending {
+			matches[idx].After = append(matches[idx].After, line)
+			if len(matches[idx].After) < opts.ContextLines {
+				stillPending = append(stillPending, idx)
+			}
+		}
+		pending = stillPending
+
+		// A match beyond the limit is only noted; earlier matches may still
+		// need this line as trailing context
+		if len(matches) >= limit {
+			if opts.Pattern.MatchString(line) {
+				more = true
+			}
+		} else if opts.Pattern.MatchString(line) {
+			match := grepMatch{
+				Line:      lineNum,
+				Timestamp: timestamp,
+				Text:      line,
+			}
+			if len(before) > 0 {
+				match.Before = append([]string{}, before...)
+			}
+			matches = append(matches, match)
+			if opts.ContextLines > 0 {
+				pending = append(pending, len(matches)-1)
+			}
+		}
+
+		if opts.ContextLines > 0 {
+			if len(before) == opts.ContextLines {
+				before = before[1:]
+			}
+			before = append(before, line)
+		}
+
+		// Stop once the limit is reached and all trailing context is collected
+		if len(matches) >= limit && len(pending) == 0 {
+			if more {
+				return matches, true, nil
+			}
+			more, err := hasMatchingLine(ctx, reader, opts.Pattern)
+			return matches, more, err
+		}
+	}
+
+	return matches, more, nil
+}
+
+// hasMatchingLine reports whether any remaining line matches the pattern
+func hasMatchingLine(ctx context.Context, reader *bufio.Reader, re *regexp.Regexp) (bool, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		line, err := readLine(reader)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if re.MatchString(line) {
+			return true, nil
+		}
+	}
+}
+
+// readLine reads a single line without its trailing newline.
+// Unlike bufio.Scanner it has no maximum line length.
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
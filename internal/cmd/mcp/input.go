@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// inputKeys maps control keys accepted by process_send_input to the input
+// sent to the process
+var inputKeys = map[string]utils.ProcessInput{
+	"enter":  {Data: "\n"},
+	"tab":    {Data: "\t"},
+	"escape": {Data: "\x1b"},
+	"ctrl_c": {Signal: "SIGINT"},
+	"ctrl_d": {EOF: true},
+}
+
+func handleProcessSendInput(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	processID, ok := args["process_id"].(string)
+	if !ok || processID == "" {
+		return nil, fmt.Errorf("process_id is required")
+	}
+
+	text, _ := args["text"].(string)
+	key, _ := args["key"].(string)
+	if text == "" && key == "" {
+		return nil, fmt.Errorf("text or key is required")
+	}
+
+	newline := true
+	if n, ok := args["newline"].(bool); ok {
+		newline = n
+	}
+
+	var keyInput utils.ProcessInput
+	if key != "" {
+		keyInput, ok = inputKeys[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %s", key)
+		}
+	}
+
+	meta, err := loadProcessMetadata(processID)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Status != "running" || !isProcessRunning(meta.PID) {
+		return nil, fmt.Errorf("process is not running (status: %s)", meta.Status)
+	}
+
+	if meta.InputPath == "" {
+		return nil, fmt.Errorf("process has no input channel (start it with dkit run --input-fifo)")
+	}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return nil, err
+	}
+	fifoPath := filepath.Join(dkitDir, "processes", processID, utils.InputFIFOName)
+
+	sent := []string{}
+	if text != "" {
+		data := text
+		if newline {
+			data += "\n"
+		}
+		if err := utils.SendProcessInput(fifoPath, utils.ProcessInput{Source: "mcp", Data: data}); err != nil {
+			return nil, err
+		}
+		sent = append(sent, "text")
+	}
+
+	if key != "" {
+		keyInput.Source = "mcp"
+		if err := utils.SendProcessInput(fifoPath, keyInput); err != nil {
+			return nil, err
+		}
+		sent = append(sent, key)
+	}
+
+	return map[string]interface{}{
+		"process_id": processID,
+		"sent":       sent,
+		"sent_at":    time.Now(),
+	}, nil
+}
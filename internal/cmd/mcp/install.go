@@ -0,0 +1,595 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/delinoio/dkit/internal/utils"
+	"github.com/spf13/cobra"
+	"github.com/tailscale/hujson"
+)
+
+// Configuration scopes
+const (
+	scopeUser    = "user"
+	scopeProject = "project"
+)
+
+// mcpClient describes where an MCP client keeps its server configuration
+type mcpClient struct {
+	name        string
+	displayName string
+
+	// serversKey is the top-level key holding the servers
+	serversKey string
+
+	// userPath returns the user-wide configuration file
+	userPath func() (string, error)
+
+	// projectPath is the project configuration file relative to the
+	// project root, or empty if the client has none
+	projectPath string
+
+	// entryType is the "type" field of a server entry, if the client uses one
+	entryType string
+}
+
+// serverEntry is the configuration of a stdio MCP server
+type serverEntry struct {
+	Type    string   `json:"type,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+var mcpClients = []mcpClient{
+	{
+		name:        "claude-desktop",
+		displayName: "Claude Desktop",
+		serversKey:  "mcpServers",
+		userPath:    userConfigPath("Claude", "claude_desktop_config.json"),
+	},
+	{
+		name:        "claude-code",
+		displayName: "Claude Code",
+		serversKey:  "mcpServers",
+		userPath:    homePath(".claude.json"),
+		projectPath: ".mcp.json",
+		entryType:   "stdio",
+	},
+	{
+		name:        "cursor",
+		displayName: "Cursor",
+		serversKey:  "mcpServers",
+		userPath:    homePath(".cursor", "mcp.json"),
+		projectPath: filepath.Join(".cursor", "mcp.json"),
+	},
+	{
+		name:        "vscode",
+		displayName: "VS Code",
+		serversKey:  "servers",
+		userPath:    userConfigPath("Code", "User", "mcp.json"),
+		projectPath: filepath.Join(".vscode", "mcp.json"),
+		entryType:   "stdio",
+	},
+	{
+		name:        "windsurf",
+		displayName: "Windsurf",
+		serversKey:  "mcpServers",
+		userPath:    homePath(".codeium", "windsurf", "mcp_config.json"),
+	},
+}
+
+// homePath returns a path below the user's home directory
+func homePath(elem ...string) func() (string, error) {
+	return func() (string, error) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(append([]string{home}, elem...)...), nil
+	}
+}
+
+// userConfigPath returns a path below the platform's user configuration
+// directory (~/.config, ~/Library/Application Support or %AppData%)
+func userConfigPath(elem ...string) func() (string, error) {
+	return func() (string, error) {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(append([]string{dir}, elem...)...), nil
+	}
+}
+
+// findMCPClient looks up a client by name
+func findMCPClient(name string) (*mcpClient, bool) {
+	for i := range mcpClients {
+		if mcpClients[i].name == name {
+			return &mcpClients[i], true
+		}
+	}
+	return nil, false
+}
+
+// mcpClientNames lists the supported client names
+func mcpClientNames() string {
+	names := []string{}
+	for _, c := range mcpClients {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, "|")
+}
+
+// installTarget is a resolved client configuration file
+type installTarget struct {
+	client      *mcpClient
+	scope       string
+	path        string
+	projectRoot string
+}
+
+// resolveInstallTarget validates the flags and finds the configuration file.
+// Invalid input exits with code 2.
+func resolveInstallTarget(clientName, scope, name string) *installTarget {
+	if clientName == "" {
+		utils.PrintError("--client is required (%s)", mcpClientNames())
+		os.Exit(2)
+	}
+	client, ok := findMCPClient(clientName)
+	if !ok {
+		utils.PrintError("Unknown client: %s (use %s)", clientName, mcpClientNames())
+		os.Exit(2)
+	}
+	if scope != scopeUser && scope != scopeProject {
+		utils.PrintError("Invalid scope: %s (use user|project)", scope)
+		os.Exit(2)
+	}
+	if strings.TrimSpace(name) == "" {
+		utils.PrintError("--name must not be empty")
+		os.Exit(2)
+	}
+
+	target := &installTarget{client: client, scope: scope}
+
+	if scope == scopeProject {
+		if client.projectPath == "" {
+			utils.PrintError("%s has no project configuration; use --scope user", client.displayName)
+			os.Exit(2)
+		}
+
+		root, err := utils.FindProjectRoot("")
+		if err != nil {
+			if root, err = os.Getwd(); err != nil {
+				utils.Fatal("Failed to get current directory: %v", err)
+			}
+		}
+		target.projectRoot = root
+		target.path = filepath.Join(root, client.projectPath)
+		return target
+	}
+
+	path, err := client.userPath()
+	if err != nil {
+		utils.Fatal("Failed to locate the %s configuration: %v", client.displayName, err)
+	}
+	target.path = path
+	return target
+}
+
+// dkitCommandPath returns the absolute path of the running dkit binary.
+// Clients start servers without the user's shell PATH, so a bare "dkit"
+// is not enough.
+func dkitCommandPath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the dkit binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+func newInstallCommand() *cobra.Command {
+	var (
+		clientName string
+		scope      string
+		name       string
+		command    string
+		dryRun     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Register the dkit MCP server with an AI client",
+		Long: `Add dkit to the MCP configuration of a local AI client.
+
+The configuration file is edited in place: comments, formatting and other
+servers are preserved. The server entry uses the absolute path of the dkit
+binary. With --scope project, the entry is written to the project's
+configuration file and pins the server to the project root with --dir.
+
+Supported clients:
+  claude-desktop  user scope only
+  claude-code     ~/.claude.json or .mcp.json
+  cursor          ~/.cursor/mcp.json or .cursor/mcp.json
+  vscode          user mcp.json or .vscode/mcp.json
+  windsurf        user scope only
+
+Examples:
+  dkit mcp install --client claude-desktop
+  dkit mcp install --client claude-code --scope project
+  dkit mcp install --client cursor --scope project --dry-run`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := resolveInstallTarget(clientName, scope, name)
+
+			if command == "" {
+				var err error
+				if command, err = dkitCommandPath(); err != nil {
+					utils.PrintError("%v", err)
+					return err
+				}
+			} else if path, err := exec.LookPath(command); err == nil {
+				if abs, err := filepath.Abs(path); err == nil {
+					command = abs
+				}
+			} else {
+				utils.PrintWarning("%s not found; writing it as given", command)
+			}
+
+			entry := serverEntry{Type: target.client.entryType, Command: command, Args: []string{"mcp"}}
+			if target.scope == scopeProject {
+				entry.Args = append(entry.Args, "--dir", target.projectRoot)
+			}
+
+			original, err := readClientConfig(target.path)
+			if err != nil {
+				utils.PrintError("%v", err)
+				return err
+			}
+
+			updated, changed, err := setServerEntry(original, target.client.serversKey, name, entry)
+			if err != nil {
+				utils.PrintError("Failed to update %s: %v", target.path, err)
+				return err
+			}
+
+			if !changed {
+				utils.PrintInfo("%s is already installed in %s", name, target.path)
+				return nil
+			}
+
+			if dryRun {
+				fmt.Print(utils.UnifiedDiff(target.path, target.path, string(original), string(updated)))
+				return nil
+			}
+
+			if err := writeClientConfig(target.path, updated); err != nil {
+				utils.PrintError("%v", err)
+				return err
+			}
+
+			utils.PrintSuccess("Installed %s in %s", name, target.path)
+			utils.PrintInfo("Restart %s to load the server", target.client.displayName)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&clientName, "client", "", "Client to configure ("+mcpClientNames()+")")
+	cmd.Flags().StringVar(&scope, "scope", scopeUser, "Configuration scope (user|project)")
+	cmd.Flags().StringVar(&name, "name", "dkit", "Server name in the client configuration")
+	cmd.Flags().StringVar(&command, "command", "", "dkit binary to run (default: the running binary)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the change as a diff without writing it")
+
+	return cmd
+}
+
+func newUninstallCommand() *cobra.Command {
+	var (
+		clientName string
+		scope      string
+		name       string
+		dryRun     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the dkit MCP server from an AI client",
+		Long: `Remove dkit from the MCP configuration of a local AI client.
+
+Comments, formatting and other servers in the configuration file are
+preserved.
+
+Examples:
+  dkit mcp uninstall --client claude-desktop
+  dkit mcp uninstall --client vscode --scope project --dry-run`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := resolveInstallTarget(clientName, scope, name)
+
+			original, err := os.ReadFile(target.path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					utils.PrintInfo("%s is not installed (%s does not exist)", name, target.path)
+					return nil
+				}
+				utils.PrintError("Failed to read %s: %v", target.path, err)
+				return err
+			}
+
+			updated, removed, err := removeServerEntry(original, target.client.serversKey, name)
+			if err != nil {
+				utils.PrintError("Failed to update %s: %v", target.path, err)
+				return err
+			}
+
+			if !removed {
+				utils.PrintInfo("%s is not installed in %s", name, target.path)
+				return nil
+			}
+
+			if dryRun {
+				fmt.Print(utils.UnifiedDiff(target.path, target.path, string(original), string(updated)))
+				return nil
+			}
+
+			if err := writeClientConfig(target.path, updated); err != nil {
+				utils.PrintError("%v", err)
+				return err
+			}
+
+			utils.PrintSuccess("Removed %s from %s", name, target.path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&clientName, "client", "", "Client to configure ("+mcpClientNames()+")")
+	cmd.Flags().StringVar(&scope, "scope", scopeUser, "Configuration scope (user|project)")
+	cmd.Flags().StringVar(&name, "name", "dkit", "Server name in the client configuration")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the change as a diff without writing it")
+
+	return cmd
+}
+
+// readClientConfig reads a client configuration file. A missing file is
+// treated as empty.
+func readClientConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// writeClientConfig writes a client configuration file, keeping the mode
+// of an existing file
+func writeClientConfig(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// setServerEntry adds or replaces a server in a JSONC configuration. Only
+// the server entry is rewritten; the rest of the file is kept byte for
+// byte. It reports whether the configuration changed.
+func setServerEntry(data []byte, serversKey, name string, entry serverEntry) ([]byte, bool, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}\n")
+	}
+
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid JSONC: %w", err)
+	}
+	rootObj, ok := root.Value.(*hujson.Object)
+	if !ok {
+		return nil, false, fmt.Errorf("configuration is not a JSON object")
+	}
+
+	indent := detectIndent(rootObj)
+
+	servers := findMember(rootObj, serversKey)
+	if servers == nil {
+		appendMember(rootObj, hujson.ObjectMember{
+			Name:  hujson.Value{BeforeExtra: hujson.Extra("\n" + indent), Value: hujson.String(serversKey)},
+			Value: hujson.Value{BeforeExtra: hujson.Extra(" "), Value: &hujson.Object{}},
+		}, "")
+		servers = &rootObj.Members[len(rootObj.Members)-1]
+	}
+	serversObj, ok := servers.Value.Value.(*hujson.Object)
+	if !ok {
+		return nil, false, fmt.Errorf("%q is not a JSON object", serversKey)
+	}
+
+	// Indent new entries like the existing ones, or one level deeper than
+	// the servers key
+	serversIndent := indent
+	if i, ok := lineIndent(servers.Name.BeforeExtra); ok {
+		serversIndent = i
+	}
+	memberIndent := serversIndent + indent
+	if len(serversObj.Members) > 0 {
+		if i, ok := lineIndent(serversObj.Members[0].Name.BeforeExtra); ok {
+			memberIndent = i
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(memberIndent, indent)
+	if err := encoder.Encode(entry); err != nil {
+		return nil, false, fmt.Errorf("failed to encode server entry: %w", err)
+	}
+	value, err := hujson.Parse(bytes.TrimSpace(buf.Bytes()))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing := findMember(serversObj, name); existing != nil {
+		if sameJSON(existing.Value, value) {
+			return root.Pack(), false, nil
+		}
+		existing.Value.Value = value.Value
+		return root.Pack(), true, nil
+	}
+
+	appendMember(serversObj, hujson.ObjectMember{
+		Name:  hujson.Value{BeforeExtra: hujson.Extra("\n" + memberIndent), Value: hujson.String(name)},
+		Value: hujson.Value{BeforeExtra: hujson.Extra(" "), Value: value.Value},
+	}, serversIndent)
+
+	return root.Pack(), true, nil
+}
+
+// removeServerEntry removes a server from a JSONC configuration and reports
+// whether it was present
+func removeServerEntry(data []byte, serversKey, name string) ([]byte, bool, error) {
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid JSONC: %w", err)
+	}
+	rootObj, ok := root.Value.(*hujson.Object)
+	if !ok {
+		return nil, false, fmt.Errorf("configuration is not a JSON object")
+	}
+
+	servers := findMember(rootObj, serversKey)
+	if servers == nil {
+		return data, false, nil
+	}
+	serversObj, ok := servers.Value.Value.(*hujson.Object)
+	if !ok {
+		return data, false, nil
+	}
+
+	for i, member := range serversObj.Members {
+		if memberName(member) != name {
+			continue
+		}
+		last := i == len(serversObj.Members)-1
+		trailingComma := serversObj.Members[len(serversObj.Members)-1].Value.AfterExtra != nil
+
+		// A comment on the line of the previous member belongs to it
+		before := string(member.Name.BeforeExtra)
+		if j := strings.Index(before, "\n"); j > 0 && strings.TrimSpace(before[:j]) != "" {
+			if last {
+				serversObj.AfterExtra = append(hujson.Extra(before[:j]), serversObj.AfterExtra...)
+			} else {
+				next := &serversObj.Members[i+1].Name
+				next.BeforeExtra = append(hujson.Extra(before[:j]), next.BeforeExtra...)
+			}
+		}
+
+		serversObj.Members = append(serversObj.Members[:i], serversObj.Members[i+1:]...)
+
+		switch {
+		case len(serversObj.Members) == 0:
+			serversObj.AfterExtra = nil
+		case last:
+			// Keep the trailing comma style of the object
+			prev := &serversObj.Members[len(serversObj.Members)-1].Value
+			if trailingComma && prev.AfterExtra == nil {
+				prev.AfterExtra = hujson.Extra{}
+			} else if !trailingComma && len(bytes.TrimSpace(prev.AfterExtra)) == 0 {
+				prev.AfterExtra = nil
+			}
+		}
+		return root.Pack(), true, nil
+	}
+
+	return data, false, nil
+}
+
+// appendMember adds a member at the end of an object. Comments on the line
+// of the previous last member stay there, and a trailing comma is kept.
+// closeIndent indents the closing brace if the object was on one line.
+func appendMember(obj *hujson.Object, member hujson.ObjectMember, closeIndent string) {
+	after := string(obj.AfterExtra)
+	if i := strings.Index(after, "\n"); i >= 0 {
+		if head := after[:i]; strings.TrimSpace(head) != "" {
+			member.Name.BeforeExtra = append(hujson.Extra(head), member.Name.BeforeExtra...)
+		}
+		obj.AfterExtra = hujson.Extra(after[i:])
+	} else {
+		obj.AfterExtra = hujson.Extra("\n" + closeIndent)
+	}
+
+	if n := len(obj.Members); n > 0 && obj.Members[n-1].Value.AfterExtra != nil {
+		member.Value.AfterExtra = hujson.Extra{}
+	}
+
+	obj.Members = append(obj.Members, member)
+}
+
+// findMember returns the member of an object with the given name
+func findMember(obj *hujson.Object, name string) *hujson.ObjectMember {
+	for i := range obj.Members {
+		if memberName(obj.Members[i]) == name {
+			return &obj.Members[i]
+		}
+	}
+	return nil
+}
+
+// memberName returns the decoded name of an object member
+func memberName(member hujson.ObjectMember) string {
+	literal, ok := member.Name.Value.(hujson.Literal)
+	if !ok {
+		return ""
+	}
+	return literal.String()
+}
+
+// lineIndent returns the indentation of the line a value starts on, if the
+// whitespace before it contains a line break
+func lineIndent(before hujson.Extra) (string, bool) {
+	s := string(before)
+	i := strings.LastIndex(s, "\n")
+	if i < 0 {
+		return "", false
+	}
+	return s[i+1:], true
+}
+
+// detectIndent returns the indentation of the top-level members, or two
+// spaces if the file has none
+func detectIndent(obj *hujson.Object) string {
+	for _, member := range obj.Members {
+		before := string(member.Name.BeforeExtra)
+		if i := strings.LastIndex(before, "\n"); i >= 0 && i < len(before)-1 {
+			return before[i+1:]
+		}
+	}
+	return "  "
+}
+
+// sameJSON reports whether two values are equal, ignoring comments and
+// formatting
+func sameJSON(a, b hujson.Value) bool {
+	a, b = a.Clone(), b.Clone()
+	a.Minimize()
+	b.Minimize()
+	return bytes.Equal(a.Pack(), b.Pack())
+}
@@ -2,12 +2,17 @@ package mcp
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/delinoio/dkit/internal/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -20,20 +25,37 @@ AI coding agents like Claude Code can connect to this server to manage dkit proc
 		RunE: runMCPServer,
 	}
 
+	cmd.Flags().String("dir", "", "Project directory to serve (default: current directory)")
+
+	cmd.AddCommand(newInstallCommand())
+	cmd.AddCommand(newUninstallCommand())
+
 	return cmd
 }
 
+// Protocol versions supported by the server, newest first
+var supportedProtocolVersions = []string{
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
 // JSON-RPC 2.0 structures
 type jsonRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
-	ID      interface{}     `json:"id,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
 }
 
+// isNotification reports whether the message expects no response
+func (r *jsonRPCRequest) isNotification() bool {
+	return len(r.ID) == 0
+}
+
 type jsonRPCResponse struct {
 	JSONRPC string      `json:"jsonrpc"`
-	ID      interface{} `json:"id,omitempty"`
+	ID      interface{} `json:"id"`
 	Result  interface{} `json:"result,omitempty"`
 	Error   *rpcError   `json:"error,omitempty"`
 }
@@ -44,6 +66,38 @@ type rpcError struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+type jsonRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// messageWriter serializes JSON-RPC messages written to the client.
+// Responses and server-initiated notifications share the same stream,
+// so every write must go through it.
+type messageWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newMessageWriter(w io.Writer) *messageWriter {
+	return &messageWriter{encoder: json.NewEncoder(w)}
+}
+
+func (w *messageWriter) write(msg interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(msg)
+}
+
+func (w *messageWriter) notify(method string, params interface{}) error {
+	return w.write(&jsonRPCNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
 // MCP protocol structures
 type serverInfo struct {
 	Name    string `json:"name"`
@@ -51,7 +105,22 @@ type serverInfo struct {
 }
 
 type serverCapabilities struct {
-	Tools struct{} `json:"tools"`
+	Tools     toolsCapability      `json:"tools"`
+	Resources *resourcesCapability `json:"resources,omitempty"`
+	Prompts   *promptsCapability   `json:"prompts,omitempty"`
+}
+
+type toolsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+type promptsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+type resourcesCapability struct {
+	Subscribe   bool `json:"subscribe"`
+	ListChanged bool `json:"listChanged"`
 }
 
 type initializeResult struct {
@@ -70,41 +139,148 @@ type toolListResult struct {
 	Tools []tool `json:"tools"`
 }
 
+type clientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// session holds state negotiated during initialize
+var session struct {
+	sync.Mutex
+	protocolVersion string
+	client          clientInfo
+	initialized     bool
+}
+
 func runMCPServer(cmd *cobra.Command, args []string) error {
-	scanner := bufio.NewScanner(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
+	// Clients usually start servers from an unrelated directory; --dir
+	// points the server at the project it should manage
+	if dir, _ := cmd.Flags().GetString("dir"); dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("failed to change to %s: %w", dir, err)
+		}
+	}
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	if err := registerCommandTools(cmd.Root()); err != nil {
+		return fmt.Errorf("failed to load MCP configuration: %w", err)
+	}
 
-		var req jsonRPCRequest
-		if err := json.Unmarshal(line, &req); err != nil {
-			sendError(encoder, nil, -32700, "Parse error", err.Error())
-			continue
+	return serve(os.Stdin, os.Stdout)
+}
+
+// serve reads newline-delimited JSON-RPC messages from in and writes the
+// responses to out until in is closed
+func serve(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	writer := newMessageWriter(out)
+
+	// Watch subscribed resources and notify the client about changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go subscriptions.watch(ctx, writer)
+
+	dispatcher := newRequestDispatcher(writer)
+	defer dispatcher.wait()
+
+	for {
+		// Messages are newline-delimited; read without a line length limit
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			req, errResp := parseMessage(line)
+			switch {
+			case errResp != nil:
+				if err := writer.write(errResp); err != nil {
+					return fmt.Errorf("failed to encode response: %w", err)
+				}
+			case req == nil:
+			case req.isNotification():
+				handleNotification(req, dispatcher)
+			default:
+				dispatcher.dispatch(ctx, req)
+			}
 		}
 
-		// Handle request
-		response := handleRequest(&req)
-		if err := encoder.Encode(response); err != nil {
-			return fmt.Errorf("failed to encode response: %w", err)
+		if err == io.EOF {
+			// The client closed its end; stop reading but answer every
+			// request already accepted (the deferred wait)
+			return nil
+		}
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to read input: %w", err)
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("scanner error: %w", err)
+// parseMessage decodes a single message. It returns an error response for
+// malformed input, and neither a request nor a response for invalid
+// notifications, which must be ignored silently.
+func parseMessage(line []byte) (*jsonRPCRequest, *jsonRPCResponse) {
+	line = bytes.TrimSpace(line)
+	if line[0] == '[' {
+		return nil, errorResponse(nil, -32600, "Invalid Request", "batch requests are not supported")
 	}
 
-	return nil
+	var req jsonRPCRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return nil, errorResponse(nil, -32700, "Parse error", err.Error())
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.isNotification() {
+			return nil, nil
+		}
+		return nil, errorResponse(req.ID, -32600, "Invalid Request", "jsonrpc must be \"2.0\" and method is required")
+	}
+
+	return &req, nil
+}
+
+// handleNotification processes client notifications, which never get a reply
+func handleNotification(req *jsonRPCRequest, dispatcher *requestDispatcher) {
+	switch req.Method {
+	case "notifications/initialized":
+		session.Lock()
+		session.initialized = true
+		session.Unlock()
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err == nil && len(params.RequestID) > 0 {
+			dispatcher.cancel(params.RequestID)
+		}
+	}
 }
 
-func handleRequest(req *jsonRPCRequest) *jsonRPCResponse {
+func handleRequest(ctx context.Context, req *jsonRPCRequest) *jsonRPCResponse {
 	switch req.Method {
 	case "initialize":
 		return handleInitialize(req)
+	case "ping":
+		return &jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  struct{}{},
+		}
 	case "tools/list":
 		return handleToolsList(req)
 	case "tools/call":
-		return handleToolsCall(req)
+		return handleToolsCall(ctx, req)
+	case "resources/list":
+		return handleResourcesList(req)
+	case "resources/templates/list":
+		return handleResourceTemplatesList(req)
+	case "resources/read":
+		return handleResourcesRead(ctx, req)
+	case "resources/subscribe":
+		return handleResourcesSubscribe(req)
+	case "resources/unsubscribe":
+		return handleResourcesUnsubscribe(req)
+	case "prompts/list":
+		return handlePromptsList(req)
+	case "prompts/get":
+		return handlePromptsGet(ctx, req)
 	default:
 		return &jsonRPCResponse{
 			JSONRPC: "2.0",
@@ -118,10 +294,38 @@ func handleRequest(req *jsonRPCRequest) *jsonRPCResponse {
 }
 
 func handleInitialize(req *jsonRPCRequest) *jsonRPCResponse {
+	var params struct {
+		ProtocolVersion string     `json:"protocolVersion"`
+		ClientInfo      clientInfo `json:"clientInfo"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errorResponse(req.ID, -32602, "Invalid params", err.Error())
+		}
+	}
+
+	// Use the client's version if we support it, otherwise offer our latest
+	// and let the client decide whether it can continue
+	version := supportedProtocolVersions[0]
+	for _, v := range supportedProtocolVersions {
+		if v == params.ProtocolVersion {
+			version = v
+			break
+		}
+	}
+
+	session.Lock()
+	session.protocolVersion = version
+	session.client = params.ClientInfo
+	session.Unlock()
+
 	result := initializeResult{
-		ProtocolVersion: "2024-11-05",
+		ProtocolVersion: version,
 		Capabilities: serverCapabilities{
-			Tools: struct{}{},
+			Resources: &resourcesCapability{
+				Subscribe: true,
+			},
+			Prompts: &promptsCapability{},
 		},
 		ServerInfo: serverInfo{
 			Name:    "dkit-mcp",
@@ -140,7 +344,7 @@ func handleToolsList(req *jsonRPCRequest) *jsonRPCResponse {
 	tools := []tool{
 		{
 			Name:        "process_list",
-			Description: "List all processes started by dkit run",
+			Description: "List all processes started by dkit run and dkit retry sessions (with their attempts)",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -188,9 +392,149 @@ func handleToolsList(req *jsonRPCRequest) *jsonRPCResponse {
 					},
 					"lines": map[string]interface{}{
 						"type":        "number",
-						"description": "Number of lines to show",
+						"description": "Number of lines to show (from the end, or from start_line)",
 						"default":     100,
 					},
+					"start_line": map[string]interface{}{
+						"type":        "number",
+						"description": "Show lines starting at this 1-based line number",
+					},
+					"max_tokens": map[string]interface{}{
+						"type":        "number",
+						"description": "Token budget: returns an excerpt of the whole log (head, tail and lines around errors) with markers for omitted lines",
+					},
+					"max_bytes": map[string]interface{}{
+						"type":        "number",
+						"description": "Byte budget, like max_tokens",
+					},
+				},
+				"required": []string{"process_id"},
+			},
+		},
+		{
+			Name:        "process_grep",
+			Description: "Search process logs with a regular expression",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "Regular expression to search for (RE2 syntax)",
+					},
+					"process_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Only search this process (default: all processes)",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "Only search processes with this status",
+						"enum":        []string{"running", "completed", "failed"},
+					},
+					"stream": map[string]interface{}{
+						"type":        "string",
+						"description": "Which stream to search",
+						"enum":        []string{"stdout", "stderr", "both"},
+						"default":     "both",
+					},
+					"case_sensitive": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Match case exactly",
+						"default":     true,
+					},
+					"context": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of context lines before and after each match",
+						"default":     0,
+					},
+					"max_matches": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of matches to return",
+						"default":     100,
+					},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+		{
+			Name:        "process_test_results",
+			Description: "Get test results (passed, failed, skipped, durations, failure messages) recorded for a go test, Jest, Vitest, pytest or cargo test run",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"process_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Process ID of the test run",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "Only return tests with this status",
+						"enum":        []string{"failed", "passed", "skipped", "all"},
+						"default":     "failed",
+					},
+					"max_tests": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of tests to return",
+						"default":     100,
+					},
+				},
+				"required": []string{"process_id"},
+			},
+		},
+		{
+			Name:        "process_diagnose",
+			Description: "Extract compiler, linter and runtime errors (Go, tsc, ESLint, Rust, Python, gcc/clang) from process logs",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"process_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Process ID to diagnose",
+					},
+					"stream": map[string]interface{}{
+						"type":        "string",
+						"description": "Which stream to parse",
+						"enum":        []string{"stdout", "stderr", "both"},
+						"default":     "both",
+					},
+					"min_severity": map[string]interface{}{
+						"type":        "string",
+						"description": "Least severe diagnostics to include",
+						"enum":        []string{"error", "warning", "info"},
+						"default":     "info",
+					},
+					"max_diagnostics": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of diagnostics to return",
+						"default":     50,
+					},
+				},
+				"required": []string{"process_id"},
+			},
+		},
+		{
+			Name:        "process_send_input",
+			Description: "Send text or control keys to the stdin of a process started with dkit run --input-fifo",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"process_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Process ID",
+					},
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "Text to write to stdin",
+					},
+					"newline": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Append a newline to text",
+						"default":     true,
+					},
+					"key": map[string]interface{}{
+						"type":        "string",
+						"description": "Control key to send after text (ctrl_c interrupts, ctrl_d closes stdin)",
+						"enum":        []string{"enter", "tab", "escape", "ctrl_c", "ctrl_d"},
+					},
 				},
 				"required": []string{"process_id"},
 			},
@@ -211,6 +555,10 @@ func handleToolsList(req *jsonRPCRequest) *jsonRPCResponse {
 						"enum":        []string{"SIGTERM", "SIGKILL"},
 						"default":     "SIGTERM",
 					},
+					"dry_run": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Only report which process would be signalled",
+					},
 				},
 				"required": []string{"process_id"},
 			},
@@ -237,11 +585,19 @@ func handleToolsList(req *jsonRPCRequest) *jsonRPCResponse {
 						"type":        "string",
 						"description": "Processes started before date (ISO 8601)",
 					},
+					"dry_run": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Only report which processes would be removed",
+					},
 				},
 			},
 		},
 	}
 
+	for _, ct := range commandTools {
+		tools = append(tools, ct.tool)
+	}
+
 	return &jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -251,7 +607,7 @@ func handleToolsList(req *jsonRPCRequest) *jsonRPCResponse {
 	}
 }
 
-func handleToolsCall(req *jsonRPCRequest) *jsonRPCResponse {
+func handleToolsCall(ctx context.Context, req *jsonRPCRequest) *jsonRPCResponse {
 	var params struct {
 		Name      string                 `json:"name"`
 		Arguments map[string]interface{} `json:"arguments"`
@@ -269,22 +625,10 @@ func handleToolsCall(req *jsonRPCRequest) *jsonRPCResponse {
 		}
 	}
 
-	// Route to appropriate tool handler
-	var result interface{}
-	var err error
-
-	switch params.Name {
-	case "process_list":
-		result, err = handleProcessList(params.Arguments)
-	case "process_show":
-		result, err = handleProcessShow(params.Arguments)
-	case "process_logs":
-		result, err = handleProcessLogs(params.Arguments)
-	case "process_kill":
-		result, err = handleProcessKill(params.Arguments)
-	case "process_clean":
-		result, err = handleProcessClean(params.Arguments)
-	default:
+	started := time.Now()
+	handler := lookupToolHandler(params.Name)
+	if handler == nil {
+		auditToolCall(params.Name, params.Arguments, nil, fmt.Errorf("unknown tool"), started)
 		return &jsonRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -296,18 +640,49 @@ func handleToolsCall(req *jsonRPCRequest) *jsonRPCResponse {
 		}
 	}
 
+	result, err := callTool(ctx, params.Name, params.Arguments, handler)
+	auditToolCall(params.Name, params.Arguments, result, err, started)
+
+	if denial := asPolicyDenial(err); denial != nil {
+		return &jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result: map[string]interface{}{
+				"content": []map[string]interface{}{
+					{
+						"type": "text",
+						"text": denial.Error(),
+					},
+				},
+				"structuredContent": denial,
+				"isError":           true,
+			},
+		}
+	}
+
+	// Tool failures are reported in the result so the model can see them;
+	// JSON-RPC errors are reserved for protocol problems
 	if err != nil {
 		return &jsonRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
-			Error: &rpcError{
-				Code:    -32603,
-				Message: "Tool execution failed",
-				Data:    err.Error(),
+			Result: map[string]interface{}{
+				"content": []map[string]interface{}{
+					{
+						"type": "text",
+						"text": err.Error(),
+					},
+				},
+				"isError": true,
 			},
 		}
 	}
 
+	isError := false
+	if f, ok := result.(interface{ failed() bool }); ok {
+		isError = f.failed()
+	}
+
 	return &jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -318,12 +693,76 @@ func handleToolsCall(req *jsonRPCRequest) *jsonRPCResponse {
 					"text": formatToolResult(result),
 				},
 			},
+			"structuredContent": result,
+			"isError":           isError,
 		},
 	}
 }
 
+// toolHandler implements a single MCP tool
+type toolHandler func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// lookupToolHandler returns the handler for a tool, or nil if there is none
+func lookupToolHandler(name string) toolHandler {
+	switch name {
+	case "process_list":
+		return handleProcessList
+	case "process_show":
+		return handleProcessShow
+	case "process_logs":
+		return handleProcessLogs
+	case "process_grep":
+		return handleProcessGrep
+	case "process_diagnose":
+		return handleProcessDiagnose
+	case "process_test_results":
+		return handleProcessTestResults
+	case "process_send_input":
+		return handleProcessSendInput
+	case "process_kill":
+		return handleProcessKill
+	case "process_clean":
+		return handleProcessClean
+	}
+
+	if ct := findCommandTool(name); ct != nil {
+		return func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return handleCommandTool(ctx, ct, args)
+		}
+	}
+	return nil
+}
+
+// callTool enforces the project policy and runs the tool handler
+func callTool(ctx context.Context, name string, args map[string]interface{}, handler toolHandler) (interface{}, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	p, err := loadPolicy()
+	if err != nil {
+		// Fail closed: an unreadable policy must not grant everything
+		return nil, &policyDenial{
+			Denied: true,
+			Tool:   name,
+			Rule:   "policy",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := p.check(name, args); err != nil {
+		return nil, err
+	}
+
+	result, err := handler(withPolicy(ctx, p), args)
+	if err == nil && isDryRun(args) && dryRunTools[name] {
+		dryRuns.record(name, args)
+	}
+	return result, err
+}
+
 // Tool handlers
-func handleProcessList(args map[string]interface{}) (interface{}, error) {
+func handleProcessList(ctx context.Context, args map[string]interface{}) (interface{}, error) {
 	index, err := loadProcessIndex()
 	if err != nil {
 		return nil, err
@@ -350,7 +789,7 @@ func handleProcessList(args map[string]interface{}) (interface{}, error) {
 	}, nil
 }
 
-func handleProcessShow(args map[string]interface{}) (interface{}, error) {
+func handleProcessShow(ctx context.Context, args map[string]interface{}) (interface{}, error) {
 	processID, ok := args["process_id"].(string)
 	if !ok || processID == "" {
 		return nil, fmt.Errorf("process_id is required")
@@ -385,7 +824,7 @@ func handleProcessShow(args map[string]interface{}) (interface{}, error) {
 		stderrSize = info.Size()
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"id":          meta.ID,
 		"pid":         meta.PID,
 		"command":     meta.Command,
@@ -401,10 +840,21 @@ func handleProcessShow(args map[string]interface{}) (interface{}, error) {
 			"stdout": stdoutSize,
 			"stderr": stderrSize,
 		},
-	}, nil
+	}
+
+	if meta.Kind != "" {
+		result["kind"] = meta.Kind
+		result["attempts"] = meta.Attempts
+	}
+
+	if results, err := loadTestResults(processID); err == nil && results != nil {
+		result["tests"] = testSummary(results)
+	}
+
+	return result, nil
 }
 
-func handleProcessLogs(args map[string]interface{}) (interface{}, error) {
+func handleProcessLogs(ctx context.Context, args map[string]interface{}) (interface{}, error) {
 	processID, ok := args["process_id"].(string)
 	if !ok || processID == "" {
 		return nil, fmt.Errorf("process_id is required")
@@ -416,42 +866,118 @@ func handleProcessLogs(args map[string]interface{}) (interface{}, error) {
 	}
 
 	lines := 100
+	_, linesSet := args["lines"].(float64)
 	if l, ok := args["lines"].(float64); ok {
 		lines = int(l)
 	}
 
+	startLine := 0
+	if s, ok := args["start_line"].(float64); ok {
+		if s < 1 {
+			return nil, fmt.Errorf("start_line must be at least 1")
+		}
+		startLine = int(s)
+	}
+
+	maxBytes := 0
+	if t, ok := args["max_tokens"].(float64); ok && t > 0 {
+		maxBytes = int(t) * utils.BytesPerToken
+	}
+	if b, ok := args["max_bytes"].(float64); ok && b > 0 {
+		maxBytes = int(b)
+	}
+
 	dkitDir, err := getDkitDir()
 	if err != nil {
 		return nil, err
 	}
 
-	stdoutPath := filepath.Join(dkitDir, "processes", processID, "stdout.log")
-	stderrPath := filepath.Join(dkitDir, "processes", processID, "stderr.log")
+	streams := []string{}
+	if stream == "stdout" || stream == "both" {
+		streams = append(streams, "stdout")
+	}
+	if stream == "stderr" || stream == "both" {
+		streams = append(streams, "stderr")
+	}
 
 	result := map[string]interface{}{
 		"process_id": processID,
 	}
 
-	if stream == "stdout" || stream == "both" {
-		stdoutLines, err := readLogFile(stdoutPath, lines)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read stdout: %w", err)
+	// Plain tail, as before budgets existed
+	if startLine == 0 && maxBytes == 0 {
+		for _, name := range streams {
+			logLines, err := readLogFile(ctx, filepath.Join(dkitDir, "processes", processID, name+".log"), lines)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			result[name] = logLines
 		}
-		result["stdout"] = stdoutLines
+		return result, nil
 	}
 
-	if stream == "stderr" || stream == "both" {
-		stderrLines, err := readLogFile(stderrPath, lines)
+	// Select the requested window of each stream: an explicit range, the
+	// last lines if given, or the whole log to excerpt from
+	windows := map[string][]string{}
+	firstLines := map[string]int{}
+	sizes := map[string]int{}
+	for _, name := range streams {
+		logLines, err := readLogFile(ctx, filepath.Join(dkitDir, "processes", processID, name+".log"), 0)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read stderr: %w", err)
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		from, to := 0, len(logLines)
+		if startLine > 0 {
+			from = startLine - 1
+			if from > len(logLines) {
+				from = len(logLines)
+			}
+			if lines > 0 && from+lines < to {
+				to = from + lines
+			}
+		} else if linesSet && lines > 0 && lines < len(logLines) {
+			from = len(logLines) - lines
 		}
-		result["stderr"] = stderrLines
+
+		windows[name] = logLines[from:to]
+		firstLines[name] = from + 1
+		for _, line := range windows[name] {
+			sizes[name] += len(line) + 1
+		}
+	}
+
+	streamSizes := make([]int, len(streams))
+	for i, name := range streams {
+		streamSizes[i] = sizes[name]
 	}
+	budgets := utils.SplitExcerptBudget(streamSizes, maxBytes)
+
+	excerpts := map[string]interface{}{}
+	for i, name := range streams {
+		excerpt := utils.BuildExcerpt(windows[name], utils.ExcerptOptions{
+			MaxBytes:  budgets[i],
+			FirstLine: firstLines[name],
+			Marker: func(from, to int) string {
+				return fmt.Sprintf("[dkit] ... %d lines omitted (lines %d-%d); fetch them with process_logs stream=%q start_line=%d lines=%d ...",
+					to-from+1, from, to, name, from, to-from+1)
+			},
+		})
+		result[name] = excerpt.Lines
+		excerpts[name] = map[string]interface{}{
+			"first_line":    firstLines[name],
+			"total_lines":   excerpt.TotalLines,
+			"shown_lines":   excerpt.ShownLines,
+			"omitted_lines": excerpt.OmittedLines,
+			"error_lines":   excerpt.ErrorLines,
+		}
+	}
+	result["excerpt"] = excerpts
 
 	return result, nil
 }
 
-func handleProcessKill(args map[string]interface{}) (interface{}, error) {
+func handleProcessKill(ctx context.Context, args map[string]interface{}) (interface{}, error) {
 	processID, ok := args["process_id"].(string)
 	if !ok || processID == "" {
 		return nil, fmt.Errorf("process_id is required")
@@ -475,11 +1001,33 @@ func handleProcessKill(args map[string]interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("process is no longer running")
 	}
 
+	if policyFromContext(ctx).onlyDkitProcesses("process_kill") {
+		if err := verifyDkitProcess(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if isDryRun(args) {
+		if signal != "SIGTERM" && signal != "SIGKILL" {
+			return nil, fmt.Errorf("unknown signal: %s", signal)
+		}
+		return map[string]interface{}{
+			"process_id": processID,
+			"pid":        meta.PID,
+			"command":    meta.Command,
+			"signal":     signal,
+			"dry_run":    true,
+		}, nil
+	}
+
 	if err := killProcess(meta.PID, signal); err != nil {
 		return nil, err
 	}
 
 	// Update process status
+	processIndexMu.Lock()
+	defer processIndexMu.Unlock()
+
 	index, err := loadProcessIndex()
 	if err != nil {
 		return nil, err
@@ -507,7 +1055,7 @@ func handleProcessKill(args map[string]interface{}) (interface{}, error) {
 	}, nil
 }
 
-func handleProcessClean(args map[string]interface{}) (interface{}, error) {
+func handleProcessClean(ctx context.Context, args map[string]interface{}) (interface{}, error) {
 	all := false
 	if a, ok := args["all"].(bool); ok {
 		all = a
@@ -532,12 +1080,21 @@ func handleProcessClean(args map[string]interface{}) (interface{}, error) {
 		beforeDate = &t
 	}
 
+	minAge, err := policyFromContext(ctx).minAge("process_clean")
+	if err != nil {
+		return nil, err
+	}
+
+	processIndexMu.Lock()
+	defer processIndexMu.Unlock()
+
 	index, err := loadProcessIndex()
 	if err != nil {
 		return nil, err
 	}
 
 	toDelete := []string{}
+	protected := []string{}
 	remaining := []ProcessMetadata{}
 
 	for _, p := range index.Processes {
@@ -553,6 +1110,12 @@ func handleProcessClean(args map[string]interface{}) (interface{}, error) {
 			shouldDelete = true
 		}
 
+		// Entries younger than the policy's min_age are kept
+		if shouldDelete && minAge > 0 && time.Since(p.StartedAt) < minAge {
+			protected = append(protected, p.ID)
+			shouldDelete = false
+		}
+
 		if shouldDelete {
 			toDelete = append(toDelete, p.ID)
 		} else {
@@ -560,12 +1123,21 @@ func handleProcessClean(args map[string]interface{}) (interface{}, error) {
 		}
 	}
 
+	if isDryRun(args) {
+		return map[string]interface{}{
+			"would_clean": toDelete,
+			"protected":   protected,
+			"dry_run":     true,
+		}, nil
+	}
+
 	// Delete process data
 	errors := []string{}
-	for _, id := range toDelete {
+	for i, id := range toDelete {
 		if err := deleteProcessData(id); err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", id, err))
 		}
+		reportProgress(ctx, float64(i+1), float64(len(toDelete)), "Removed "+id)
 	}
 
 	// Update index
@@ -575,8 +1147,9 @@ func handleProcessClean(args map[string]interface{}) (interface{}, error) {
 	}
 
 	return map[string]interface{}{
-		"cleaned": len(toDelete),
-		"errors":  errors,
+		"cleaned":   len(toDelete),
+		"protected": protected,
+		"errors":    errors,
 	}, nil
 }
 
@@ -588,8 +1161,8 @@ func formatToolResult(result interface{}) string {
 	return string(data)
 }
 
-func sendError(encoder *json.Encoder, id interface{}, code int, message string, data interface{}) {
-	response := &jsonRPCResponse{
+func errorResponse(id interface{}, code int, message string, data interface{}) *jsonRPCResponse {
+	return &jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &rpcError{
@@ -598,5 +1171,4 @@ func sendError(encoder *json.Encoder, id interface{}, code int, message string,
 			Data:    data,
 		},
 	}
-	encoder.Encode(response)
 }
@@ -0,0 +1,385 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDryRunWindow is how long a dry run satisfies require_dry_run
+	defaultDryRunWindow = 10 * time.Minute
+
+	// processStartTolerance bounds the difference between the recorded start
+	// time of a dkit process and the start time reported by the OS
+	processStartTolerance = 5 * time.Second
+)
+
+// dryRunTools lists the tools that accept a dry_run argument
+var dryRunTools = map[string]bool{
+	"process_kill":  true,
+	"process_clean": true,
+}
+
+// policy is the project policy read from .dkit/policy.json (JSONC).
+// Tool keys may be exact tool names or glob patterns such as "*" or
+// "dkit_port_*"; every matching rule applies.
+type policy struct {
+	Tools map[string]toolPolicy `json:"tools"`
+}
+
+// toolPolicy restricts how a tool may be called
+type toolPolicy struct {
+	// Deny rejects every call to the tool
+	Deny   bool   `json:"deny"`
+	Reason string `json:"reason"`
+
+	// RequireDryRun rejects a call unless the same call was made with
+	// dry_run: true within DryRunWindow
+	RequireDryRun bool   `json:"require_dry_run"`
+	DryRunWindow  string `json:"dry_run_window"`
+
+	// OnlyDkitProcesses rejects signalling a PID that no longer belongs to
+	// the process dkit started (e.g. after PID reuse)
+	OnlyDkitProcesses bool `json:"only_dkit_processes"`
+
+	// MinAge protects process entries younger than this from being cleaned
+	MinAge string `json:"min_age"`
+
+	// Arguments restricts individual argument values
+	Arguments map[string]argumentPolicy `json:"arguments"`
+}
+
+// argumentPolicy restricts the values of a single tool argument.
+// Array values are checked element by element against Allow and Deny, and
+// joined with spaces for AllowPrefixes.
+type argumentPolicy struct {
+	Allow         []interface{} `json:"allow"`
+	Deny          []interface{} `json:"deny"`
+	AllowPrefixes []string      `json:"allow_prefixes"`
+}
+
+// policyDenial is returned when a policy rule rejects a tool call. It is
+// reported to the client as structured content.
+type policyDenial struct {
+	Denied   bool   `json:"denied"`
+	Tool     string `json:"tool"`
+	Rule     string `json:"rule"`
+	Policy   string `json:"policy,omitempty"`
+	Argument string `json:"argument,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (d *policyDenial) Error() string {
+	return fmt.Sprintf("denied by policy (%s): %s", d.Rule, d.Reason)
+}
+
+// asPolicyDenial returns the policy denial wrapped in err, if any
+func asPolicyDenial(err error) *policyDenial {
+	var denial *policyDenial
+	if errors.As(err, &denial) {
+		return denial
+	}
+	return nil
+}
+
+// loadPolicy loads .dkit/policy.json, returning an empty policy if the
+// project has no .dkit directory or no policy file
+func loadPolicy() (*policy, error) {
+	p := &policy{}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return p, nil
+	}
+
+	if err := readJSONCFile(filepath.Join(dkitDir, "policy.json"), p); err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// matchingRules returns the rules that apply to a tool, keyed by the
+// pattern that matched, in a stable order
+func (p *policy) matchingRules(toolName string) ([]string, []toolPolicy) {
+	keys := []string{}
+	for key := range p.Tools {
+		if ok, _ := filepath.Match(key, toolName); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	rules := make([]toolPolicy, 0, len(keys))
+	for _, key := range keys {
+		rules = append(rules, p.Tools[key])
+	}
+	return keys, rules
+}
+
+// check enforces the rules that can be decided from the call alone
+func (p *policy) check(toolName string, args map[string]interface{}) error {
+	keys, rules := p.matchingRules(toolName)
+
+	for i, rule := range rules {
+		deny := func(name, argument, reason string) error {
+			return &policyDenial{
+				Denied:   true,
+				Tool:     toolName,
+				Rule:     name,
+				Policy:   keys[i],
+				Argument: argument,
+				Reason:   reason,
+			}
+		}
+
+		if rule.Deny {
+			reason := rule.Reason
+			if reason == "" {
+				reason = "tool is disabled by the project policy"
+			}
+			return deny("deny", "", reason)
+		}
+
+		argNames := make([]string, 0, len(rule.Arguments))
+		for name := range rule.Arguments {
+			argNames = append(argNames, name)
+		}
+		sort.Strings(argNames)
+
+		for _, name := range argNames {
+			value, ok := args[name]
+			if !ok {
+				continue
+			}
+			if reason := rule.Arguments[name].check(value); reason != "" {
+				return deny("arguments", name, reason)
+			}
+		}
+
+		if rule.RequireDryRun && !isDryRun(args) {
+			if !dryRunTools[toolName] {
+				return deny("require_dry_run", "", "tool does not support dry_run")
+			}
+			window, err := parsePolicyDuration(rule.DryRunWindow, defaultDryRunWindow)
+			if err != nil {
+				return deny("require_dry_run", "", fmt.Sprintf("invalid dry_run_window: %v", err))
+			}
+			if !dryRuns.consume(toolName, args, window) {
+				return deny("require_dry_run", "", fmt.Sprintf("call %s with the same arguments and dry_run: true first (valid for %s)", toolName, window))
+			}
+		}
+	}
+
+	return nil
+}
+
+// onlyDkitProcesses reports whether any rule for the tool requires
+// verifying process ownership
+func (p *policy) onlyDkitProcesses(toolName string) bool {
+	_, rules := p.matchingRules(toolName)
+	for _, rule := range rules {
+		if rule.OnlyDkitProcesses {
+			return true
+		}
+	}
+	return false
+}
+
+// minAge returns the largest min_age configured for the tool
+func (p *policy) minAge(toolName string) (time.Duration, error) {
+	_, rules := p.matchingRules(toolName)
+
+	var age time.Duration
+	for _, rule := range rules {
+		d, err := parsePolicyDuration(rule.MinAge, 0)
+		if err != nil {
+			return 0, fmt.Errorf("invalid min_age: %w", err)
+		}
+		if d > age {
+			age = d
+		}
+	}
+	return age, nil
+}
+
+// check returns a reason if value is not permitted, or "" if it is
+func (a argumentPolicy) check(value interface{}) string {
+	values := []interface{}{value}
+	if items, ok := value.([]interface{}); ok {
+		values = items
+	}
+
+	for _, v := range values {
+		s := formatArgValue(v)
+		if len(a.Allow) > 0 && !containsArgValue(a.Allow, s) {
+			return fmt.Sprintf("value %q is not in the allowed list", s)
+		}
+		if containsArgValue(a.Deny, s) {
+			return fmt.Sprintf("value %q is denied", s)
+		}
+	}
+
+	if len(a.AllowPrefixes) > 0 {
+		parts := make([]string, 0, len(values))
+		for _, v := range values {
+			parts = append(parts, formatArgValue(v))
+		}
+		joined := strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+		if !matchesCommandPath(joined, a.AllowPrefixes) {
+			return fmt.Sprintf("%q does not start with an allowed prefix (%s)", joined, strings.Join(a.AllowPrefixes, ", "))
+		}
+	}
+
+	return ""
+}
+
+// containsArgValue reports whether s equals any of the configured values
+func containsArgValue(values []interface{}, s string) bool {
+	for _, v := range values {
+		if formatArgValue(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePolicyDuration parses a Go duration, additionally accepting whole
+// days such as "1d" or "7d"
+func parsePolicyDuration(s string, def time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// isDryRun reports whether a call asks for a dry run
+func isDryRun(args map[string]interface{}) bool {
+	dryRun, _ := args["dry_run"].(bool)
+	return dryRun
+}
+
+// dryRunRecorder remembers recent dry runs so that require_dry_run can be
+// satisfied by the matching real call
+type dryRunRecorder struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var dryRuns = &dryRunRecorder{seen: map[string]time.Time{}}
+
+// dryRunKey identifies a call independently of its dry_run flag
+func dryRunKey(toolName string, args map[string]interface{}) string {
+	canonical := map[string]interface{}{}
+	for k, v := range args {
+		if k != "dry_run" {
+			canonical[k] = v
+		}
+	}
+	data, _ := json.Marshal(canonical)
+	return toolName + " " + string(data)
+}
+
+func (r *dryRunRecorder) record(toolName string, args map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen[dryRunKey(toolName, args)] = time.Now()
+}
+
+// consume reports whether a matching dry run happened within window, and
+// forgets it so each dry run authorizes a single call
+func (r *dryRunRecorder) consume(toolName string, args map[string]interface{}, window time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := dryRunKey(toolName, args)
+	at, ok := r.seen[key]
+	if !ok {
+		return false
+	}
+	delete(r.seen, key)
+	return time.Since(at) <= window
+}
+
+type policyKey struct{}
+
+// withPolicy attaches the policy in effect to a tool call
+func withPolicy(ctx context.Context, p *policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// policyFromContext returns the policy in effect, or an empty policy
+func policyFromContext(ctx context.Context) *policy {
+	if p, ok := ctx.Value(policyKey{}).(*policy); ok {
+		return p
+	}
+	return &policy{}
+}
+
+// verifyDkitProcess checks that pid still belongs to the process dkit
+// started, by comparing the OS start time with the recorded start time
+func verifyDkitProcess(meta *ProcessMetadata) error {
+	denial := &policyDenial{
+		Denied: true,
+		Tool:   "process_kill",
+		Rule:   "only_dkit_processes",
+	}
+
+	if meta.PID <= 0 {
+		denial.Reason = "process has no recorded PID"
+		return denial
+	}
+
+	started, err := processStartTime(meta.PID)
+	if err != nil {
+		denial.Reason = fmt.Sprintf("cannot verify that PID %d was started by dkit: %v", meta.PID, err)
+		return denial
+	}
+
+	// ps reports whole seconds derived from the boot time, which can drift
+	// from the wall clock, so allow some slack on either side
+	if started.Before(meta.StartedAt.Add(-processStartTolerance)) || started.After(meta.StartedAt.Add(processStartTolerance)) {
+		denial.Reason = fmt.Sprintf("PID %d was started at %s, not by dkit at %s (PID reused?)",
+			meta.PID, started.Format(time.RFC3339), meta.StartedAt.Format(time.RFC3339))
+		return denial
+	}
+
+	return nil
+}
+
+// processStartTime returns when a process started, according to ps
+func processStartTime(pid int) (time.Time, error) {
+	cmd := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid))
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	output, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to run ps: %w", err)
+	}
+
+	started, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(string(output)), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected ps output %q", strings.TrimSpace(string(output)))
+	}
+	return started, nil
+}
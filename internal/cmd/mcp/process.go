@@ -1,13 +1,19 @@
 package mcp
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
 )
 
 // Process metadata structure (from run/AGENTS.md)
@@ -23,6 +29,11 @@ type ProcessMetadata struct {
 	ExitCode   *int       `json:"exit_code,omitempty"`
 	StdoutPath string     `json:"stdout_path"`
 	StderrPath string     `json:"stderr_path"`
+	InputPath  string     `json:"input_path,omitempty"`
+
+	// Retry sessions list their attempts
+	Kind     string                 `json:"kind,omitempty"`
+	Attempts []utils.ProcessAttempt `json:"attempts,omitempty"`
 }
 
 // ProcessIndex represents the process registry
@@ -55,6 +66,10 @@ func getDkitDir() (string, error) {
 	return "", fmt.Errorf(".dkit directory not found in project")
 }
 
+// processIndexMu serializes handlers that load, modify and save the
+// process registry, since requests are handled concurrently
+var processIndexMu sync.Mutex
+
 // loadProcessIndex loads the process registry
 func loadProcessIndex() (*ProcessIndex, error) {
 	dkitDir, err := getDkitDir()
@@ -120,29 +135,38 @@ func loadProcessMetadata(processID string) (*ProcessMetadata, error) {
 	return &meta, nil
 }
 
-// readLogFile reads the last N lines from a log file
-func readLogFile(filePath string, lines int) ([]string, error) {
-	data, err := os.ReadFile(filePath)
+// readLogFile reads the last N lines from a log file.
+// The file is streamed so only the requested lines are kept in memory.
+func readLogFile(ctx context.Context, filePath string, lines int) ([]string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []string{}, nil
 		}
 		return nil, fmt.Errorf("failed to read log file: %w", err)
 	}
+	defer file.Close()
 
-	// Split by newlines
+	reader := bufio.NewReader(file)
 	allLines := []string{}
-	currentLine := ""
-	for _, b := range data {
-		if b == '\n' {
-			allLines = append(allLines, currentLine)
-			currentLine = ""
-		} else {
-			currentLine += string(b)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+
+		allLines = append(allLines, line)
+		// Keep only the last N lines
+		if lines > 0 && len(allLines) > 2*lines {
+			allLines = append(allLines[:0], allLines[len(allLines)-lines:]...)
 		}
-	}
-	if currentLine != "" {
-		allLines = append(allLines, currentLine)
 	}
 
 	// Return last N lines
@@ -0,0 +1,299 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPromptLineLength trims very long log lines (minified output, progress bars)
+	maxPromptLineLength = 500
+)
+
+type prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Arguments   []promptArgument `json:"arguments,omitempty"`
+}
+
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type promptMessage struct {
+	Role    string                 `json:"role"`
+	Content map[string]interface{} `json:"content"`
+}
+
+var prompts = []prompt{
+	{
+		Name:        "diagnose_failed_process",
+		Description: "Diagnose why a process started by dkit run failed",
+		Arguments: []promptArgument{
+			{Name: "process_id", Description: "Process ID of the failed run", Required: true},
+		},
+	},
+	{
+		Name:        "summarize_run",
+		Description: "Summarize what happened during a dkit run",
+		Arguments: []promptArgument{
+			{Name: "process_id", Description: "Process ID to summarize", Required: true},
+		},
+	},
+	{
+		Name:        "compare_runs",
+		Description: "Compare a run with an earlier run of the same command",
+		Arguments: []promptArgument{
+			{Name: "process_id", Description: "Process ID of the run to examine", Required: true},
+			{Name: "baseline_id", Description: "Process ID to compare against (default: previous successful run of the same command)", Required: false},
+		},
+	},
+}
+
+func handlePromptsList(req *jsonRPCRequest) *jsonRPCResponse {
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"prompts": prompts,
+		},
+	}
+}
+
+func handlePromptsGet(ctx context.Context, req *jsonRPCRequest) *jsonRPCResponse {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errorResponse(req.ID, -32602, "Invalid params", err.Error())
+	}
+
+	processID := params.Arguments["process_id"]
+	if processID == "" {
+		return errorResponse(req.ID, -32602, "Invalid params", "process_id is required")
+	}
+
+	var description, text string
+	var err error
+
+	switch params.Name {
+	case "diagnose_failed_process":
+		description = "Diagnose failed process " + processID
+		text, err = buildDiagnosePrompt(ctx, processID)
+	case "summarize_run":
+		description = "Summarize process " + processID
+		text, err = buildSummarizePrompt(ctx, processID)
+	case "compare_runs":
+		description = "Compare process " + processID + " with an earlier run"
+		text, err = buildComparePrompt(ctx, processID, params.Arguments["baseline_id"])
+	default:
+		return errorResponse(req.ID, -32602, "Unknown prompt", params.Name)
+	}
+
+	if err != nil {
+		return errorResponse(req.ID, -32602, "Invalid params", err.Error())
+	}
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"description": description,
+			"messages": []promptMessage{
+				{
+					Role: "user",
+					Content: map[string]interface{}{
+						"type": "text",
+						"text": text,
+					},
+				},
+			},
+		},
+	}
+}
+
+func buildDiagnosePrompt(ctx context.Context, processID string) (string, error) {
+	meta, err := loadPromptProcess(processID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The command `%s` was run with dkit run", meta.Command)
+	if meta.Status == "failed" {
+		b.WriteString(" and failed.")
+	} else {
+		fmt.Fprintf(&b, " and is currently %s.", meta.Status)
+	}
+	b.WriteString(" Identify the root cause of the failure from the information below and suggest a concrete fix.")
+	b.WriteString(" Focus on the first real error rather than follow-up noise.\n\n")
+
+	writeProcessSummary(&b, meta)
+	writeLogExcerpt(ctx, &b, processID, "stderr", 0, 80)
+	writeLogExcerpt(ctx, &b, processID, "stdout", 0, 40)
+
+	return b.String(), nil
+}
+
+func buildSummarizePrompt(ctx context.Context, processID string) (string, error) {
+	meta, err := loadPromptProcess(processID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summarize the run of `%s` below in a few sentences: what it did, whether it succeeded,", meta.Command)
+	b.WriteString(" and any warnings or errors worth following up on.\n\n")
+
+	writeProcessSummary(&b, meta)
+	writeLogExcerpt(ctx, &b, processID, "stdout", 20, 40)
+	writeLogExcerpt(ctx, &b, processID, "stderr", 0, 40)
+
+	return b.String(), nil
+}
+
+func buildComparePrompt(ctx context.Context, processID, baselineID string) (string, error) {
+	meta, err := loadPromptProcess(processID)
+	if err != nil {
+		return "", err
+	}
+
+	if baselineID == "" {
+		baselineID, err = findBaselineRun(meta)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	baseline, err := loadPromptProcess(baselineID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("Compare the two runs below. Explain what changed between the baseline and the current run,")
+	b.WriteString(" and if the current run regressed, point to the most likely cause.\n\n")
+
+	b.WriteString("# Current run\n\n")
+	writeProcessSummary(&b, meta)
+	writeLogExcerpt(ctx, &b, processID, "stderr", 0, 40)
+	writeLogExcerpt(ctx, &b, processID, "stdout", 0, 40)
+
+	b.WriteString("# Baseline run\n\n")
+	writeProcessSummary(&b, baseline)
+	writeLogExcerpt(ctx, &b, baselineID, "stderr", 0, 40)
+	writeLogExcerpt(ctx, &b, baselineID, "stdout", 0, 40)
+
+	return b.String(), nil
+}
+
+// loadPromptProcess loads process metadata and corrects stale running status
+func loadPromptProcess(processID string) (*ProcessMetadata, error) {
+	meta, err := loadProcessMetadata(processID)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Status == "running" && !isProcessRunning(meta.PID) {
+		meta.Status = "failed"
+		if meta.ExitCode == nil {
+			code := -1
+			meta.ExitCode = &code
+		}
+	}
+
+	return meta, nil
+}
+
+// findBaselineRun finds the most recent earlier run of the same command,
+// preferring one that completed successfully
+func findBaselineRun(meta *ProcessMetadata) (string, error) {
+	index, err := loadProcessIndex()
+	if err != nil {
+		return "", err
+	}
+
+	fallback := ""
+	for _, p := range filterProcesses(index.Processes, "", 0) {
+		if p.ID == meta.ID || p.Command != meta.Command || !p.StartedAt.Before(meta.StartedAt) {
+			continue
+		}
+		if p.Status == "completed" {
+			return p.ID, nil
+		}
+		if fallback == "" {
+			fallback = p.ID
+		}
+	}
+
+	if fallback == "" {
+		return "", fmt.Errorf("no earlier run of %q found; pass baseline_id explicitly", meta.Command)
+	}
+	return fallback, nil
+}
+
+// writeProcessSummary writes the metadata section of a prompt
+func writeProcessSummary(b *strings.Builder, meta *ProcessMetadata) {
+	b.WriteString("## Process\n\n")
+	fmt.Fprintf(b, "- ID: %s\n", meta.ID)
+	fmt.Fprintf(b, "- Command: %s\n", meta.Command)
+	fmt.Fprintf(b, "- Working directory: %s\n", meta.CWD)
+	fmt.Fprintf(b, "- Status: %s\n", meta.Status)
+	if meta.ExitCode != nil {
+		fmt.Fprintf(b, "- Exit code: %d\n", *meta.ExitCode)
+	}
+	fmt.Fprintf(b, "- Started: %s\n", meta.StartedAt.Format(time.RFC3339))
+	if meta.EndedAt != nil {
+		fmt.Fprintf(b, "- Ended: %s\n", meta.EndedAt.Format(time.RFC3339))
+		fmt.Fprintf(b, "- Duration: %s\n", meta.EndedAt.Sub(meta.StartedAt).Round(time.Millisecond))
+	}
+	b.WriteString("\n")
+}
+
+// writeLogExcerpt writes the first head and last tail lines of a log stream
+func writeLogExcerpt(ctx context.Context, b *strings.Builder, processID, stream string, head, tail int) {
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return
+	}
+
+	lines, err := readLogFile(ctx, filepath.Join(dkitDir, "processes", processID, stream+".log"), 0)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(b, "## %s", stream)
+	if len(lines) == 0 {
+		b.WriteString(" (empty)\n\n")
+		return
+	}
+
+	excerpt := lines
+	omitted := 0
+	if head+tail < len(lines) {
+		omitted = len(lines) - head - tail
+		excerpt = append(append([]string{}, lines[:head]...), lines[len(lines)-tail:]...)
+		fmt.Fprintf(b, " (%d of %d lines)", head+tail, len(lines))
+	}
+	b.WriteString("\n\n```\n")
+
+	for i, line := range excerpt {
+		if omitted > 0 && i == head {
+			fmt.Fprintf(b, "... %d lines omitted ...\n", omitted)
+		}
+		if len(line) > maxPromptLineLength {
+			line = line[:maxPromptLineLength] + "..."
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	b.WriteString("```\n\n")
+}
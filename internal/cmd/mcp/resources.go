@@ -0,0 +1,372 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	resourceURIPrefix = "dkit://process/"
+
+	// maxResourceBytes caps how much of a log is returned by resources/read.
+	// Larger logs are returned from the end, since the tail is usually what
+	// an agent needs.
+	maxResourceBytes = 1 << 20
+
+	// resourcePollInterval controls how often subscribed resources are checked
+	resourcePollInterval = time.Second
+)
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type resourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// resourceKinds lists the resources exposed for each process
+var resourceKinds = []struct {
+	kind        string
+	description string
+	mimeType    string
+}{
+	{"stdout", "Standard output log", "text/plain"},
+	{"stderr", "Standard error log", "text/plain"},
+	{"meta", "Process metadata and status", "application/json"},
+}
+
+// processResourceURI builds the resource URI for a process
+func processResourceURI(processID, kind string) string {
+	return resourceURIPrefix + processID + "/" + kind
+}
+
+// parseResourceURI splits a dkit://process/<id>/<kind> URI
+func parseResourceURI(uri string) (string, string, error) {
+	if !strings.HasPrefix(uri, resourceURIPrefix) {
+		return "", "", fmt.Errorf("unsupported resource URI: %s", uri)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(uri, resourceURIPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[0] == "." || parts[0] == ".." {
+		return "", "", fmt.Errorf("invalid resource URI: %s", uri)
+	}
+
+	for _, k := range resourceKinds {
+		if k.kind == parts[1] {
+			return parts[0], parts[1], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unknown resource type: %s", parts[1])
+}
+
+func handleResourcesList(req *jsonRPCRequest) *jsonRPCResponse {
+	index, err := loadProcessIndex()
+	if err != nil {
+		return errorResponse(req.ID, -32603, "Failed to load processes", err.Error())
+	}
+
+	resources := []resource{}
+	for _, p := range filterProcesses(index.Processes, "", 0) {
+		for _, k := range resourceKinds {
+			resources = append(resources, resource{
+				URI:         processResourceURI(p.ID, k.kind),
+				Name:        fmt.Sprintf("%s (%s)", p.Command, k.kind),
+				Description: fmt.Sprintf("%s of process %s [%s]", k.description, p.ID, p.Status),
+				MimeType:    k.mimeType,
+			})
+		}
+	}
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"resources": resources,
+		},
+	}
+}
+
+func handleResourceTemplatesList(req *jsonRPCRequest) *jsonRPCResponse {
+	templates := []resourceTemplate{}
+	for _, k := range resourceKinds {
+		templates = append(templates, resourceTemplate{
+			URITemplate: resourceURIPrefix + "{process_id}/" + k.kind,
+			Name:        "process-" + k.kind,
+			Description: k.description + " of a process started by dkit run",
+			MimeType:    k.mimeType,
+		})
+	}
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"resourceTemplates": templates,
+		},
+	}
+}
+
+func handleResourcesRead(ctx context.Context, req *jsonRPCRequest) *jsonRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return errorResponse(req.ID, -32602, "Invalid params", "uri is required")
+	}
+
+	processID, kind, err := parseResourceURI(params.URI)
+	if err != nil {
+		return errorResponse(req.ID, -32602, "Invalid params", err.Error())
+	}
+
+	contents, err := readProcessResource(ctx, processID, kind)
+	if err != nil {
+		return errorResponse(req.ID, -32002, "Resource not found", params.URI)
+	}
+	contents.URI = params.URI
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"contents": []resourceContents{*contents},
+		},
+	}
+}
+
+func handleResourcesSubscribe(req *jsonRPCRequest) *jsonRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return errorResponse(req.ID, -32602, "Invalid params", "uri is required")
+	}
+
+	processID, kind, err := parseResourceURI(params.URI)
+	if err != nil {
+		return errorResponse(req.ID, -32602, "Invalid params", err.Error())
+	}
+
+	if _, err := loadProcessMetadata(processID); err != nil {
+		return errorResponse(req.ID, -32002, "Resource not found", params.URI)
+	}
+
+	subscriptions.add(params.URI, resourceState(processID, kind))
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  struct{}{},
+	}
+}
+
+func handleResourcesUnsubscribe(req *jsonRPCRequest) *jsonRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return errorResponse(req.ID, -32602, "Invalid params", "uri is required")
+	}
+
+	subscriptions.remove(params.URI)
+
+	return &jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  struct{}{},
+	}
+}
+
+// readProcessResource returns the contents of a process resource
+func readProcessResource(ctx context.Context, processID, kind string) (*resourceContents, error) {
+	if kind == "meta" {
+		meta, err := handleProcessShow(ctx, map[string]interface{}{"process_id": processID})
+		if err != nil {
+			return nil, err
+		}
+		return &resourceContents{
+			MimeType: "application/json",
+			Text:     formatToolResult(meta),
+		}, nil
+	}
+
+	if _, err := loadProcessMetadata(processID); err != nil {
+		return nil, err
+	}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := readLogTail(filepath.Join(dkitDir, "processes", processID, kind+".log"), maxResourceBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resourceContents{
+		MimeType: "text/plain",
+		Text:     text,
+	}, nil
+}
+
+// readLogTail reads at most maxBytes from the end of a log file
+func readLogTail(filePath string, maxBytes int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read log file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read log file: %w", err)
+	}
+
+	if info.Size() > maxBytes {
+		if _, err := file.Seek(info.Size()-maxBytes, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to read log file: %w", err)
+		}
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read log file: %w", err)
+	}
+
+	text := string(data)
+	if info.Size() > maxBytes {
+		// Drop the partial first line
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+		text = fmt.Sprintf("[dkit] ... %d earlier bytes omitted ...\n", info.Size()-int64(len(text))) + text
+	}
+
+	return text, nil
+}
+
+// resourceState returns a fingerprint that changes whenever the resource does.
+// Logs change when they grow; metadata changes when the process changes state.
+func resourceState(processID, kind string) string {
+	if kind == "meta" {
+		meta, err := loadProcessMetadata(processID)
+		if err != nil {
+			return "missing"
+		}
+		status := meta.Status
+		if status == "running" && !isProcessRunning(meta.PID) {
+			status = "failed"
+		}
+		exitCode := ""
+		if meta.ExitCode != nil {
+			exitCode = fmt.Sprintf("%d", *meta.ExitCode)
+		}
+		return status + ":" + exitCode
+	}
+
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return "missing"
+	}
+
+	info, err := os.Stat(filepath.Join(dkitDir, "processes", processID, kind+".log"))
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%d", info.Size())
+}
+
+// subscriptionManager tracks subscribed resources and their last known state
+type subscriptionManager struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+var subscriptions = &subscriptionManager{states: map[string]string{}}
+
+func (m *subscriptionManager) add(uri, state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[uri] = state
+}
+
+func (m *subscriptionManager) remove(uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, uri)
+}
+
+// watch polls subscribed resources and sends notifications/resources/updated
+// whenever one of them changes, until ctx is cancelled.
+func (m *subscriptionManager) watch(ctx context.Context, writer *messageWriter) {
+	ticker := time.NewTicker(resourcePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, uri := range m.changed() {
+			writer.notify("notifications/resources/updated", map[string]interface{}{
+				"uri": uri,
+			})
+		}
+	}
+}
+
+// changed returns the subscribed URIs whose state differs from the last check
+func (m *subscriptionManager) changed() []string {
+	m.mu.Lock()
+	uris := make([]string, 0, len(m.states))
+	for uri := range m.states {
+		uris = append(uris, uri)
+	}
+	m.mu.Unlock()
+
+	updated := []string{}
+	for _, uri := range uris {
+		processID, kind, err := parseResourceURI(uri)
+		if err != nil {
+			continue
+		}
+		state := resourceState(processID, kind)
+
+		m.mu.Lock()
+		last, ok := m.states[uri]
+		if ok && last != state {
+			m.states[uri] = state
+			updated = append(updated, uri)
+		}
+		m.mu.Unlock()
+	}
+
+	return updated
+}
@@ -0,0 +1,146 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// maxConcurrentRequests bounds how many requests are handled at once.
+// Further requests wait for a free slot, while notifications such as
+// cancellations are still processed immediately by the read loop.
+const maxConcurrentRequests = 8
+
+// errRequestCancelled is the cancellation cause for notifications/cancelled
+var errRequestCancelled = errors.New("request cancelled by client")
+
+// requestDispatcher handles requests concurrently and tracks them so they
+// can be cancelled by the client
+type requestDispatcher struct {
+	writer   *messageWriter
+	slots    chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	inFlight map[string]context.CancelCauseFunc
+}
+
+func newRequestDispatcher(writer *messageWriter) *requestDispatcher {
+	return &requestDispatcher{
+		writer:   writer,
+		slots:    make(chan struct{}, maxConcurrentRequests),
+		inFlight: map[string]context.CancelCauseFunc{},
+	}
+}
+
+// dispatch handles req in the background and writes its response, unless
+// the client cancelled it in the meantime
+func (d *requestDispatcher) dispatch(ctx context.Context, req *jsonRPCRequest) {
+	key := requestKey(req.ID)
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	reqCtx = withProgressReporter(reqCtx, d.writer, req.Params)
+
+	d.mu.Lock()
+	d.inFlight[key] = cancel
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() {
+			d.mu.Lock()
+			delete(d.inFlight, key)
+			d.mu.Unlock()
+			cancel(nil)
+		}()
+
+		// Wait for a free slot
+		select {
+		case d.slots <- struct{}{}:
+		case <-reqCtx.Done():
+			return
+		}
+		response := handleRequest(reqCtx, req)
+		<-d.slots
+
+		// The receiver of a cancellation must not send a response
+		if errors.Is(context.Cause(reqCtx), errRequestCancelled) {
+			return
+		}
+		d.writer.write(response)
+	}()
+}
+
+// cancel aborts an in-flight request
+func (d *requestDispatcher) cancel(id json.RawMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cancel, ok := d.inFlight[requestKey(id)]; ok {
+		cancel(errRequestCancelled)
+	}
+}
+
+// wait blocks until all dispatched requests have finished
+func (d *requestDispatcher) wait() {
+	d.wg.Wait()
+}
+
+// requestKey normalizes a request ID so equal IDs compare equal
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+type progressKey struct{}
+
+// progressReporter sends notifications/progress for a single request
+type progressReporter struct {
+	writer *messageWriter
+	token  interface{}
+}
+
+// withProgressReporter attaches a progress reporter to ctx when the request
+// carries a _meta.progressToken
+func withProgressReporter(ctx context.Context, writer *messageWriter, params json.RawMessage) context.Context {
+	var p struct {
+		Meta struct {
+			ProgressToken interface{} `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if len(params) == 0 || json.Unmarshal(params, &p) != nil || p.Meta.ProgressToken == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, progressKey{}, &progressReporter{
+		writer: writer,
+		token:  p.Meta.ProgressToken,
+	})
+}
+
+// reportProgress notifies the client about progress on the current request.
+// It does nothing if the client did not ask for progress updates. A total of
+// zero means the total is unknown.
+func reportProgress(ctx context.Context, progress, total float64, message string) {
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok || ctx.Err() != nil {
+		return
+	}
+
+	params := map[string]interface{}{
+		"progressToken": reporter.token,
+		"progress":      progress,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if message != "" {
+		params["message"] = message
+	}
+
+	reporter.writer.notify("notifications/progress", params)
+}
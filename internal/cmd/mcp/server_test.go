@@ -0,0 +1,377 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// message is a decoded server message: a response or a notification
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// toolResult is the result of tools/call
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+// newProject creates a project with a .dkit directory and makes it the
+// working directory of the test
+func newProject(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, ".dkit", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".dkit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+}
+
+// exchangeTimeout bounds how long exchange waits for the expected replies
+const exchangeTimeout = 10 * time.Second
+
+// exchange sends frames to the server and returns the messages it wrote,
+// keyed by request ID. Like a client that is done, it closes the input
+// once replies responses have arrived, or right after the last frame if
+// replies is 0.
+func exchange(t *testing.T, replies int, frames ...string) ([]message, map[string]message) {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		err := serve(inR, outW)
+		outW.Close()
+		served <- err
+	}()
+
+	var closeOnce sync.Once
+	closeInput := func() { closeOnce.Do(func() { inW.Close() }) }
+	timer := time.AfterFunc(exchangeTimeout, closeInput)
+	defer timer.Stop()
+
+	go func() {
+		for _, frame := range frames {
+			if _, err := io.WriteString(inW, frame+"\n"); err != nil {
+				return
+			}
+		}
+		if replies == 0 {
+			closeInput()
+		}
+	}()
+
+	var messages []message
+	byID := map[string]message{}
+	scanner := bufio.NewScanner(outR)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, msg)
+		if len(msg.ID) > 0 {
+			byID[compactJSON(msg.ID)] = msg
+			if len(byID) == replies {
+				closeInput()
+			}
+		}
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	return messages, byID
+}
+
+// compactJSON removes insignificant whitespace from raw JSON
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func request(id int, method string, params string) string {
+	if params == "" {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q}`, id, method)
+	}
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":%s}`, id, method, params)
+}
+
+func initialize(id int, version string) string {
+	return request(id, "initialize", fmt.Sprintf(
+		`{"protocolVersion":%q,"capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}`, version))
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+	}{
+		{"2025-06-18", "2025-06-18"},
+		{"2025-03-26", "2025-03-26"},
+		{"2024-11-05", "2024-11-05"},
+		{"1999-01-01", supportedProtocolVersions[0]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requested, func(t *testing.T) {
+			newProject(t, nil)
+			_, byID := exchange(t, 1, initialize(1, tt.requested))
+
+			resp, ok := byID["1"]
+			if !ok || resp.Error != nil {
+				t.Fatalf("initialize failed: %+v", resp)
+			}
+			var result initializeResult
+			if err := json.Unmarshal(resp.Result, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.ProtocolVersion != tt.want {
+				t.Errorf("protocolVersion = %s, want %s", result.ProtocolVersion, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtocolMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []string
+		// replies is the number of messages the server must write
+		replies int
+		id      string
+		code    int // expected JSON-RPC error code, or 0 for a result
+		result  string
+	}{
+		{
+			name:    "ping",
+			frames:  []string{request(1, "ping", "")},
+			replies: 1,
+			id:      "1",
+			result:  `{}`,
+		},
+		{
+			name: "notifications get no reply",
+			frames: []string{
+				`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+				`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":42}}`,
+				`{"jsonrpc":"2.0","method":"notifications/unknown"}`,
+			},
+			replies: 0,
+		},
+		{
+			name:    "unknown method",
+			frames:  []string{request(7, "does/not/exist", "")},
+			replies: 1,
+			id:      "7",
+			code:    -32601,
+		},
+		{
+			name:    "malformed JSON",
+			frames:  []string{`{"jsonrpc":"2.0","id":1,`},
+			replies: 1,
+			id:      "null",
+			code:    -32700,
+		},
+		{
+			name:    "batch",
+			frames:  []string{`[` + request(1, "ping", "") + `]`},
+			replies: 1,
+			id:      "null",
+			code:    -32600,
+		},
+		{
+			name:    "missing method",
+			frames:  []string{`{"jsonrpc":"2.0","id":3}`},
+			replies: 1,
+			id:      "3",
+			code:    -32600,
+		},
+		{
+			name:    "long line",
+			frames:  []string{request(2, "ping", `{"padding":"`+strings.Repeat("x", 256*1024)+`"}`)},
+			replies: 1,
+			id:      "2",
+			result:  `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newProject(t, nil)
+			messages, _ := exchange(t, tt.replies, tt.frames...)
+
+			if len(messages) != tt.replies {
+				t.Fatalf("got %d messages, want %d: %+v", len(messages), tt.replies, messages)
+			}
+			if tt.replies == 0 {
+				return
+			}
+
+			msg := messages[0]
+			if got := compactJSON(msg.ID); got != tt.id {
+				t.Errorf("id = %s, want %s", got, tt.id)
+			}
+			if tt.code != 0 {
+				if msg.Error == nil || msg.Error.Code != tt.code {
+					t.Fatalf("error = %+v, want code %d", msg.Error, tt.code)
+				}
+				return
+			}
+			if msg.Error != nil {
+				t.Fatalf("unexpected error: %+v", msg.Error)
+			}
+			if got := compactJSON(msg.Result); got != tt.result {
+				t.Errorf("result = %s, want %s", got, tt.result)
+			}
+		})
+	}
+}
+
+func TestToolResults(t *testing.T) {
+	policy := `{
+		// Denied calls are tool failures with a structured reason
+		"tools": { "process_clean": { "deny": true, "reason": "not here" } }
+	}`
+
+	tests := []struct {
+		name       string
+		call       string
+		isError    bool
+		structured bool
+		text       string
+	}{
+		{
+			name:       "success",
+			call:       `{"name":"process_list","arguments":{}}`,
+			structured: true,
+		},
+		{
+			name:    "handler error",
+			call:    `{"name":"process_show","arguments":{}}`,
+			isError: true,
+			text:    "process_id is required",
+		},
+		{
+			name:       "policy denial",
+			call:       `{"name":"process_clean","arguments":{"all":true}}`,
+			isError:    true,
+			structured: true,
+			text:       "not here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newProject(t, map[string]string{"policy.json": policy})
+			_, byID := exchange(t, 1, request(1, "tools/call", tt.call))
+
+			resp, ok := byID["1"]
+			if !ok {
+				t.Fatal("no response")
+			}
+			if resp.Error != nil {
+				t.Fatalf("tool failures must not be JSON-RPC errors: %+v", resp.Error)
+			}
+
+			var result toolResult
+			if err := json.Unmarshal(resp.Result, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.IsError != tt.isError {
+				t.Errorf("isError = %v, want %v", result.IsError, tt.isError)
+			}
+			if got := len(result.StructuredContent) > 0; got != tt.structured {
+				t.Errorf("structuredContent present = %v, want %v", got, tt.structured)
+			}
+			if len(result.Content) != 1 || result.Content[0].Type != "text" {
+				t.Fatalf("content = %+v, want a single text item", result.Content)
+			}
+			if !strings.Contains(result.Content[0].Text, tt.text) {
+				t.Errorf("text = %q, want it to contain %q", result.Content[0].Text, tt.text)
+			}
+		})
+	}
+
+	t.Run("unknown tool", func(t *testing.T) {
+		newProject(t, nil)
+		_, byID := exchange(t, 1, request(1, "tools/call", `{"name":"no_such_tool"}`))
+		if resp := byID["1"]; resp.Error == nil || resp.Error.Code != -32602 {
+			t.Errorf("error = %+v, want code -32602", resp.Error)
+		}
+	})
+}
+
+// TestEOFAnswersAcceptedRequests closes the input right after many
+// requests; each of them must still be answered
+func TestEOFAnswersAcceptedRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+	}{
+		{"single", 1},
+		{"within concurrency limit", maxConcurrentRequests},
+		{"queued for a slot", maxConcurrentRequests * 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newProject(t, nil)
+
+			frames := []string{initialize(1, supportedProtocolVersions[0])}
+			for i := 0; i < tt.requests; i++ {
+				switch i % 3 {
+				case 0:
+					frames = append(frames, request(i+2, "ping", ""))
+				case 1:
+					frames = append(frames, request(i+2, "tools/list", ""))
+				default:
+					frames = append(frames, request(i+2, "tools/call", `{"name":"process_grep","arguments":{"pattern":"error"}}`))
+				}
+			}
+
+			_, byID := exchange(t, 0, frames...)
+			for i := 1; i <= tt.requests+1; i++ {
+				resp, ok := byID[fmt.Sprint(i)]
+				if !ok {
+					t.Errorf("request %d got no response", i)
+					continue
+				}
+				if resp.Error != nil {
+					t.Errorf("request %d failed: %+v", i, resp.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// loadTestResults loads tests.json recorded by dkit run, or nil if the
+// process did not run a recognized test framework
+func loadTestResults(processID string) (*utils.TestResults, error) {
+	dkitDir, err := getDkitDir()
+	if err != nil {
+		return nil, err
+	}
+	return utils.LoadTestResults(filepath.Dir(dkitDir), processID)
+}
+
+// testSummary is the compact form of test results shown by process_show
+func testSummary(results *utils.TestResults) map[string]interface{} {
+	failed := []string{}
+	for _, t := range results.FailedTests() {
+		name := t.Name
+		if t.Suite != "" {
+			name = t.Suite + ": " + t.Name
+		}
+		failed = append(failed, name)
+	}
+
+	return map[string]interface{}{
+		"framework":    results.Framework,
+		"passed":       results.Passed,
+		"failed":       results.Failed,
+		"skipped":      results.Skipped,
+		"duration_ms":  results.DurationMs,
+		"failed_tests": failed,
+	}
+}
+
+func handleProcessTestResults(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	processID, ok := args["process_id"].(string)
+	if !ok || processID == "" {
+		return nil, fmt.Errorf("process_id is required")
+	}
+
+	status := utils.TestFailed
+	if s, ok := args["status"].(string); ok {
+		switch s {
+		case "all", utils.TestPassed, utils.TestFailed, utils.TestSkipped:
+			status = s
+		default:
+			return nil, fmt.Errorf("invalid status: %s", s)
+		}
+	}
+
+	limit := 100
+	if m, ok := args["max_tests"].(float64); ok && m > 0 {
+		limit = int(m)
+	}
+
+	if _, err := loadProcessMetadata(processID); err != nil {
+		return nil, err
+	}
+
+	results, err := loadTestResults(processID)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		return nil, fmt.Errorf("no test results recorded for process %s (no supported test framework output found)", processID)
+	}
+
+	tests := []utils.TestCase{}
+	for _, t := range results.Tests {
+		if status == "all" || t.Status == status {
+			tests = append(tests, t)
+		}
+	}
+
+	total := len(tests)
+	truncated := false
+	if total > limit {
+		tests = tests[:limit]
+		truncated = true
+	}
+
+	return map[string]interface{}{
+		"process_id":  processID,
+		"framework":   results.Framework,
+		"passed":      results.Passed,
+		"failed":      results.Failed,
+		"skipped":     results.Skipped,
+		"duration_ms": results.DurationMs,
+		"tests":       tests,
+		"matched":     total,
+		"truncated":   truncated,
+	}, nil
+}
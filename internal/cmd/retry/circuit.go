@@ -0,0 +1,524 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// Circuit states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// exitCircuitOpen is the exit code when an open circuit makes dkit retry
+// fail fast (EX_TEMPFAIL)
+const exitCircuitOpen = 75
+
+var circuitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// circuitState is the state of a circuit, stored in
+// .dkit/circuits/<name>.json and shared by every dkit retry --circuit
+// invocation in the project
+type circuitState struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+
+	// Failures are the failed sessions since the last success that are
+	// still within the window
+	Failures []time.Time `json:"failures"`
+
+	OpenedAt       *time.Time `json:"opened_at,omitempty"`
+	ProbeStartedAt *time.Time `json:"probe_started_at,omitempty"`
+	ProbePID       int        `json:"probe_pid,omitempty"`
+	LastFailureAt  *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+
+	// Settings of the last invocation, for dkit retry circuit status
+	Threshold int    `json:"threshold"`
+	Window    string `json:"window"`
+	Cooldown  string `json:"cooldown"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// retryAt returns when an open circuit allows a probe run
+func (s *circuitState) retryAt() time.Time {
+	cooldown, _ := time.ParseDuration(s.Cooldown)
+	if s.OpenedAt == nil {
+		return time.Time{}
+	}
+	return s.OpenedAt.Add(cooldown)
+}
+
+// recentFailures returns the failures within the window
+func (s *circuitState) recentFailures(now time.Time) []time.Time {
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return s.Failures
+	}
+	recent := []time.Time{}
+	for _, t := range s.Failures {
+		if now.Sub(t) <= window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// circuitBreaker guards a dkit retry session with a persistent circuit
+type circuitBreaker struct {
+	path      string
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	state     circuitState
+
+	// probing is set if this session is the half-open probe run
+	probing bool
+}
+
+// validateCircuitName rejects names that cannot be used as file names
+func validateCircuitName(name string) error {
+	if !circuitNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid circuit name: %s (use letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// circuitsDir returns .dkit/circuits of the current project
+func circuitsDir() (string, error) {
+	dataDir, err := utils.GetDkitDataDir("")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "circuits"), nil
+}
+
+// parseCircuit validates the --circuit flags and loads the circuit
+func parseCircuit(opts retryOptions) (*circuitBreaker, error) {
+	if opts.circuitThreshold < 1 {
+		return nil, fmt.Errorf("--circuit-threshold must be at least 1")
+	}
+	window, err := parseDuration(opts.circuitWindow)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid --circuit-window duration: %s", opts.circuitWindow)
+	}
+	cooldown, err := parseDuration(opts.circuitCooldown)
+	if err != nil || cooldown < 0 {
+		return nil, fmt.Errorf("invalid --circuit-cooldown duration: %s", opts.circuitCooldown)
+	}
+	return openCircuit(opts.circuit, opts.circuitThreshold, window, cooldown)
+}
+
+// openCircuit loads the named circuit; a new circuit starts closed
+func openCircuit(name string, threshold int, window, cooldown time.Duration) (*circuitBreaker, error) {
+	if err := validateCircuitName(name); err != nil {
+		return nil, err
+	}
+
+	dir, err := circuitsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &circuitBreaker{
+		path:      filepath.Join(dir, name+".json"),
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		state:     circuitState{Name: name},
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// allow reports whether a session may run. An open circuit lets a single
+// probe run through once the cool-down has passed. The decision and the
+// claim of the probe happen under the circuit lock, so only one session
+// becomes the probe.
+func (c *circuitBreaker) allow(now time.Time) (bool, string) {
+	unlock := c.lock()
+	defer unlock()
+
+	if err := c.load(); err != nil {
+		utils.PrintWarning("Failed to load circuit %s: %v", c.state.Name, err)
+	}
+
+	switch c.state.State {
+	case circuitOpen:
+		if retryAt := c.state.retryAt(); now.Before(retryAt) {
+			return false, fmt.Sprintf("circuit %s is open after %d failed sessions; failing fast until %s (%s left)",
+				c.state.Name, len(c.state.Failures), retryAt.Format("15:04:05"), formatDuration(retryAt.Sub(now).Round(time.Second)))
+		}
+	case circuitHalfOpen:
+		if c.state.ProbePID != os.Getpid() && processExists(c.state.ProbePID) {
+			return false, fmt.Sprintf("circuit %s is half-open and a probe run is in progress (PID %d)",
+				c.state.Name, c.state.ProbePID)
+		}
+	default:
+		return true, ""
+	}
+
+	// Become the probe run
+	c.probing = true
+	c.state.State = circuitHalfOpen
+	c.state.ProbeStartedAt = &now
+	c.state.ProbePID = os.Getpid()
+	if err := c.save(now); err != nil {
+		utils.PrintWarning("Failed to save circuit %s: %v", c.state.Name, err)
+	}
+	return true, ""
+}
+
+// record updates the circuit with the outcome of the session. Only
+// sessions that ran out of attempts count as failures; sessions stopped
+// early by a skip rule, a hook or an interrupt say nothing about the
+// dependency. Other sessions may have changed the circuit meanwhile, so it
+// is reloaded under the lock first.
+func (c *circuitBreaker) record(exitCode int, exhausted bool, now time.Time) {
+	unlock := c.lock()
+	defer unlock()
+
+	if err := c.load(); err != nil {
+		utils.PrintWarning("Failed to load circuit %s: %v", c.state.Name, err)
+		return
+	}
+
+	switch {
+	case exitCode == 0:
+		if c.state.State != circuitClosed {
+			utils.PrintInfo("Circuit %s closed", c.state.Name)
+		}
+		c.state.State = circuitClosed
+		c.state.Failures = []time.Time{}
+		c.state.OpenedAt = nil
+		c.state.LastSuccessAt = &now
+
+	case !exhausted:
+		// Let the next session probe instead
+		if !c.probing {
+			return
+		}
+		c.state.State = circuitOpen
+
+	default:
+		c.state.Failures = append(c.state.recentFailures(now), now)
+		c.state.LastFailureAt = &now
+
+		if c.probing || (c.state.State != circuitOpen && len(c.state.Failures) >= c.threshold) {
+			c.state.State = circuitOpen
+			c.state.OpenedAt = &now
+			utils.PrintWarning("Circuit %s opened after %d failed sessions; dkit retry --circuit %s fails fast for %s",
+				c.state.Name, len(c.state.Failures), c.state.Name, formatDuration(c.cooldown))
+		}
+	}
+
+	c.state.ProbeStartedAt = nil
+	c.state.ProbePID = 0
+	if err := c.save(now); err != nil {
+		utils.PrintWarning("Failed to save circuit %s: %v", c.state.Name, err)
+	}
+}
+
+// lock serializes access to the circuit across dkit retry sessions. If the
+// lock cannot be taken the circuit is used without it.
+func (c *circuitBreaker) lock() func() {
+	unlock, err := lockCircuit(filepath.Dir(c.path), c.state.Name)
+	if err != nil {
+		utils.PrintWarning("Failed to lock circuit %s: %v", c.state.Name, err)
+		return func() {}
+	}
+	return unlock
+}
+
+// lockCircuit takes the lock of a circuit. Lock files are kept next to the
+// state files and never removed, so that waiting sessions lock the same file.
+func lockCircuit(dir, name string) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return lockFile(filepath.Join(dir, name+".lock"))
+}
+
+func (c *circuitBreaker) load() error {
+	name := c.state.Name
+	c.state = circuitState{
+		Name:      name,
+		State:     circuitClosed,
+		Threshold: c.threshold,
+		Window:    c.window.String(),
+		Cooldown:  c.cooldown.String(),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", c.path, err)
+	}
+
+	// Keep the settings of this invocation
+	c.state.Threshold = c.threshold
+	c.state.Window = c.window.String()
+	c.state.Cooldown = c.cooldown.String()
+	return nil
+}
+
+// save writes the state through a temporary file so that concurrent
+// sessions never read a partial file
+func (c *circuitBreaker) save(now time.Time) error {
+	c.state.UpdatedAt = now
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".circuit-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// loadCircuits returns the stored circuits, sorted by name
+func loadCircuits() ([]circuitState, error) {
+	dir, err := circuitsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	circuits := []circuitState{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var state circuitState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if state.Name == "" {
+			state.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		circuits = append(circuits, state)
+	}
+
+	sort.Slice(circuits, func(i, j int) bool {
+		return circuits[i].Name < circuits[j].Name
+	})
+	return circuits, nil
+}
+
+func newCircuitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "circuit",
+		Short: "Manage retry circuit breakers",
+		Long: `Manage the circuit breakers used by dkit retry --circuit.
+
+A circuit opens after --circuit-threshold failed sessions within
+--circuit-window. While it is open, dkit retry --circuit fails fast with
+exit code 75. After --circuit-cooldown a single probe attempt is allowed:
+if it succeeds the circuit closes, otherwise it opens again.`,
+	}
+
+	cmd.AddCommand(newCircuitStatusCommand())
+	cmd.AddCommand(newCircuitResetCommand())
+
+	return cmd
+}
+
+func newCircuitStatusCommand() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "status [name]",
+		Short: "Show circuit breaker state",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+			return runCircuitStatus(name, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
+}
+
+func runCircuitStatus(name string, jsonOutput bool) error {
+	circuits, err := loadCircuits()
+	if err != nil {
+		utils.PrintError("Failed to load circuits: %v", err)
+		return err
+	}
+
+	if name != "" {
+		filtered := []circuitState{}
+		for _, c := range circuits {
+			if c.Name == name {
+				filtered = append(filtered, c)
+			}
+		}
+		if len(filtered) == 0 {
+			utils.PrintError("Circuit not found: %s", name)
+			os.Exit(1)
+		}
+		circuits = filtered
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(circuits, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(circuits) == 0 {
+		utils.PrintInfo("No circuits")
+		return nil
+	}
+
+	now := time.Now()
+	rows := [][]string{{"NAME", "STATE", "FAILURES", "THRESHOLD", "OPENED", "RETRY AT"}}
+	for _, c := range circuits {
+		opened, retryAt := "-", "-"
+		if c.State != circuitClosed && c.OpenedAt != nil {
+			opened = c.OpenedAt.Local().Format("2006-01-02 15:04:05")
+			if at := c.retryAt(); now.Before(at) {
+				retryAt = at.Local().Format("15:04:05")
+			} else {
+				retryAt = "now"
+			}
+		}
+		rows = append(rows, []string{
+			c.Name,
+			c.State,
+			fmt.Sprint(len(c.recentFailures(now))),
+			fmt.Sprint(c.Threshold),
+			opened,
+			retryAt,
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		fmt.Println(strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	return nil
+}
+
+func newCircuitResetCommand() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "reset [name...]",
+		Short: "Close circuit breakers and forget their failures",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCircuitReset(args, all)
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Reset every circuit")
+
+	return cmd
+}
+
+func runCircuitReset(names []string, all bool) error {
+	if all == (len(names) > 0) {
+		utils.PrintError("Specify circuit names or --all")
+		os.Exit(2)
+	}
+
+	dir, err := circuitsDir()
+	if err != nil {
+		return err
+	}
+
+	if all {
+		circuits, err := loadCircuits()
+		if err != nil {
+			utils.PrintError("Failed to load circuits: %v", err)
+			return err
+		}
+		for _, c := range circuits {
+			names = append(names, c.Name)
+		}
+	}
+
+	for _, name := range names {
+		if err := validateCircuitName(name); err != nil {
+			utils.PrintError("%v", err)
+			os.Exit(2)
+		}
+
+		path := filepath.Join(dir, name+".json")
+		unlock, err := lockCircuit(dir, name)
+		if err != nil {
+			utils.PrintError("Failed to lock circuit %s: %v", name, err)
+			return err
+		}
+		err = os.Remove(path)
+		unlock()
+		if err != nil {
+			if os.IsNotExist(err) {
+				utils.PrintWarning("Circuit not found: %s", name)
+				continue
+			}
+			utils.PrintError("Failed to reset circuit %s: %v", name, err)
+			return err
+		}
+		utils.PrintSuccess("Circuit %s reset", name)
+	}
+
+	return nil
+}
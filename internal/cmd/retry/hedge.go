@@ -0,0 +1,247 @@
+package retry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// hedgeCopy is a running copy of a hedged attempt. Its terminal output is
+// held back in temporary files until it is known whether it won.
+type hedgeCopy struct {
+	number    int
+	attempt   int // attempt number in the session
+	started   time.Time
+	interrupt chan os.Signal
+	stdout    *os.File
+	stderr    *os.File
+
+	// cancelled is set when the copy is stopped because another one won
+	cancelled bool
+}
+
+// hedgeResult is a finished copy
+type hedgeResult struct {
+	copy   *hedgeCopy
+	result attemptResult
+}
+
+// hedgeOptions controls dkit retry --hedge-after
+type hedgeOptions struct {
+	after       time.Duration
+	maxParallel int
+
+	// deadline is when --max-total-time runs out, or zero without one
+	deadline time.Time
+}
+
+// runHedged runs one attempt as a hedged request: whenever hedge.after
+// passes without a success, another copy of the command starts, up to
+// hedge.maxParallel copies. The first copy that succeeds wins and the
+// others are killed without a grace period, so the winner's result is not
+// held up by them. Only the winner's output reaches stdout; failed copies
+// show their stderr. Each copy's timeout is cut to the time left before
+// hedge.deadline when it starts, and no copy starts after it.
+//
+// Every copy is recorded as an attempt of the session. The result is the
+// winner's, or that of the last copy that failed.
+func runHedged(args []string, label string, hedge hedgeOptions, opts execOptions, rules *retryRules,
+	session *retrySession, interrupt <-chan os.Signal) (attemptResult, bool, string) {
+
+	results := make(chan hedgeResult, hedge.maxParallel)
+	running := map[*hedgeCopy]bool{}
+	copies := []*hedgeCopy{}
+	defer func() {
+		for _, c := range copies {
+			c.discard()
+		}
+	}()
+
+	start := func() {
+		c := &hedgeCopy{
+			number:    len(copies) + 1,
+			started:   time.Now(),
+			interrupt: make(chan os.Signal, 2),
+		}
+		copies = append(copies, c)
+
+		copyLabel := label
+		if c.number > 1 {
+			copyLabel = fmt.Sprintf("%s (copy %d)", label, c.number)
+		}
+		attempt, stdoutLog, stderrLog := session.beginAttempt(copyLabel)
+		c.attempt = attempt
+
+		copyOpts := opts
+		if left := hedge.remaining(); left > 0 && (copyOpts.timeout == 0 || left < copyOpts.timeout) {
+			copyOpts.timeout = left
+		}
+		copyOpts.interrupt = c.interrupt
+		copyOpts.stdout = c.holdStdout()
+		copyOpts.stderr = c.holdStderr()
+
+		running[c] = true
+		go func() {
+			results <- hedgeResult{copy: c, result: executeCommand(args, copyOpts, stdoutLog, stderrLog)}
+		}()
+	}
+
+	var hedgeTimer *time.Timer
+	var hedgeC <-chan time.Time
+	scheduleHedge := func() {
+		if len(copies) < hedge.maxParallel && (hedge.deadline.IsZero() || hedge.remaining() > hedge.after) {
+			hedgeTimer = time.NewTimer(hedge.after)
+			hedgeC = hedgeTimer.C
+		} else {
+			hedgeC = nil
+		}
+	}
+	stopHedge := func() {
+		if hedgeTimer != nil {
+			hedgeTimer.Stop()
+		}
+		hedgeC = nil
+	}
+	defer stopHedge()
+
+	// forward sends a signal to every running copy without blocking
+	forward := func(sig os.Signal) {
+		for c := range running {
+			select {
+			case c.interrupt <- sig:
+			default:
+			}
+		}
+	}
+
+	start()
+	scheduleHedge()
+
+	var winner, last *hedgeResult
+	var winnerReason, lastReason string
+	interrupted := false
+
+	for len(running) > 0 {
+		select {
+		case <-hedgeC:
+			utils.PrintInfo("No result after %s, starting copy %d...", formatDuration(hedge.after), len(copies)+1)
+			start()
+			scheduleHedge()
+
+		case sig := <-interrupt:
+			interrupted = true
+			stopHedge()
+			forward(sig)
+
+		case r := <-results:
+			delete(running, r.copy)
+			r.result.cancelled = r.copy.cancelled
+			session.endAttempt(r.copy.attempt, r.result, r.copy.started)
+
+			switch {
+			case r.copy.cancelled:
+				if opts.verbose {
+					utils.PrintInfo("Copy %d stopped", r.copy.number)
+				}
+				continue
+			case r.result.interrupted:
+				session.recordOutcome(r.copy.attempt, false, "interrupted")
+				continue
+			}
+
+			success, reason := rules.evaluate(r.result)
+			session.recordOutcome(r.copy.attempt, success, reason)
+
+			if success && winner == nil && !interrupted {
+				winner, winnerReason = &r, reason
+				stopHedge()
+				for c := range running {
+					c.cancelled = true
+				}
+				forward(syscall.SIGKILL)
+				if len(copies) > 1 {
+					utils.PrintInfo("Copy %d finished first", r.copy.number)
+				}
+				r.copy.replay(os.Stdout, os.Stderr)
+				continue
+			}
+
+			if !success {
+				last, lastReason = &r, reason
+				r.copy.replay(io.Discard, os.Stderr)
+				if len(running) > 0 {
+					utils.PrintInfo("✗ Copy %d failed: %s", r.copy.number, reason)
+				}
+			}
+		}
+	}
+
+	switch {
+	case winner != nil:
+		return winner.result, true, winnerReason
+	case interrupted:
+		return attemptResult{exitCode: exitInterrupted, interrupted: true}, false, "interrupted"
+	default:
+		return last.result, false, lastReason
+	}
+}
+
+// remaining returns the time left before the deadline, or -1 without one
+func (h hedgeOptions) remaining() time.Duration {
+	if h.deadline.IsZero() {
+		return -1
+	}
+	return max(time.Until(h.deadline), 0)
+}
+
+// holdStdout returns where the copy's stdout is held back, falling back to
+// discarding it if no temporary file can be created
+func (c *hedgeCopy) holdStdout() io.Writer {
+	f, err := os.CreateTemp("", "dkit-hedge-*.stdout")
+	if err != nil {
+		utils.PrintWarning("Failed to buffer output of copy %d: %v", c.number, err)
+		return io.Discard
+	}
+	c.stdout = f
+	return f
+}
+
+// holdStderr is holdStdout for stderr
+func (c *hedgeCopy) holdStderr() io.Writer {
+	f, err := os.CreateTemp("", "dkit-hedge-*.stderr")
+	if err != nil {
+		utils.PrintWarning("Failed to buffer output of copy %d: %v", c.number, err)
+		return io.Discard
+	}
+	c.stderr = f
+	return f
+}
+
+// replay copies the held back output to the terminal
+func (c *hedgeCopy) replay(stdout, stderr io.Writer) {
+	for _, held := range []struct {
+		file *os.File
+		dest io.Writer
+	}{{c.stdout, stdout}, {c.stderr, stderr}} {
+		if held.file == nil || held.dest == io.Discard {
+			continue
+		}
+		if _, err := held.file.Seek(0, io.SeekStart); err == nil {
+			io.Copy(held.dest, held.file)
+		}
+	}
+}
+
+// discard removes the held back output
+func (c *hedgeCopy) discard() {
+	for _, f := range []*os.File{c.stdout, c.stderr} {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+}
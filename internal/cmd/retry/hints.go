@@ -0,0 +1,153 @@
+package retry
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secondaryRateLimitDelay is the wait GitHub recommends after hitting a
+// secondary rate limit that did not come with Retry-After
+const secondaryRateLimitDelay = time.Minute
+
+// delayHint recognizes a wait requested in the output of a failed attempt
+type delayHint struct {
+	name    string
+	pattern *regexp.Regexp
+
+	// parse converts the last match into a delay
+	parse func(match []string, now time.Time) (time.Duration, bool)
+}
+
+// builtinDelayHints are tried in order unless --no-delay-hints is set
+var builtinDelayHints = []delayHint{
+	{
+		// Retry-After: 30, or an HTTP date
+		name:    "Retry-After",
+		pattern: regexp.MustCompile(`(?im)retry-after:[ \t]*([^\r\n]+?)[ \t]*$`),
+		parse: func(match []string, now time.Time) (time.Duration, bool) {
+			if seconds, err := strconv.Atoi(match[1]); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second, true
+			}
+			if t, err := http.ParseTime(match[1]); err == nil {
+				return max(t.Sub(now), 0), true
+			}
+			return 0, false
+		},
+	},
+	{
+		// X-RateLimit-Reset: <unix time>, as sent by GitHub and others
+		name:    "X-RateLimit-Reset",
+		pattern: regexp.MustCompile(`(?im)x-ratelimit-reset:[ \t]*(\d{9,})[ \t]*$`),
+		parse: func(match []string, now time.Time) (time.Duration, bool) {
+			epoch, err := strconv.ParseInt(match[1], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return max(time.Unix(epoch, 0).Sub(now), 0), true
+		},
+	},
+	{
+		// "try again in 45s", "retry after 2 minutes", "please wait 10 seconds"
+		name:    "try again in",
+		pattern: regexp.MustCompile(`(?i)\b(?:try again|retry|wait)(?: in| after)?\s+(\d+(?:\.\d+)?\s*(?:ms|milliseconds?|s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?))\b`),
+		parse: func(match []string, now time.Time) (time.Duration, bool) {
+			return parseHintDuration(match[1])
+		},
+	},
+	{
+		// GitHub's secondary rate limit message does not say how long to wait
+		name:    "secondary rate limit",
+		pattern: regexp.MustCompile(`(?i)secondary rate limit`),
+		parse: func(match []string, now time.Time) (time.Duration, bool) {
+			return secondaryRateLimitDelay, true
+		},
+	},
+}
+
+// newOutputDelayHint builds the hint for --delay-from-output. The first
+// capture group holds the delay.
+func newOutputDelayHint(pattern string) (*delayHint, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern in --delay-from-output: %s", pattern)
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("--delay-from-output needs a capture group for the delay: %s", pattern)
+	}
+
+	return &delayHint{
+		name:    "--delay-from-output",
+		pattern: re,
+		parse: func(match []string, now time.Time) (time.Duration, bool) {
+			return parseHintDuration(match[1])
+		},
+	}, nil
+}
+
+// findDelayHint returns the delay requested by the first hint that matches
+// the output, using its last occurrence
+func findDelayHint(hints []delayHint, result attemptResult, now time.Time) (time.Duration, string, bool) {
+	output := result.stderr + "\n" + result.stdout
+	for _, h := range hints {
+		matches := h.pattern.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if d, ok := h.parse(matches[len(matches)-1], now); ok {
+			return d, h.name, true
+		}
+	}
+	return 0, "", false
+}
+
+// hintUnits maps the units accepted in hints to durations
+var hintUnits = map[string]time.Duration{
+	"":             time.Second,
+	"ms":           time.Millisecond,
+	"millisecond":  time.Millisecond,
+	"milliseconds": time.Millisecond,
+	"s":            time.Second,
+	"sec":          time.Second,
+	"secs":         time.Second,
+	"second":       time.Second,
+	"seconds":      time.Second,
+	"m":            time.Minute,
+	"min":          time.Minute,
+	"mins":         time.Minute,
+	"minute":       time.Minute,
+	"minutes":      time.Minute,
+	"h":            time.Hour,
+	"hr":           time.Hour,
+	"hrs":          time.Hour,
+	"hour":         time.Hour,
+	"hours":        time.Hour,
+}
+
+var hintDurationPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-z]*)$`)
+
+// parseHintDuration parses a delay such as "30", "1m30s", "2.5s" or
+// "45 seconds". A bare number is in seconds.
+func parseHintDuration(s string) (time.Duration, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, true
+	}
+
+	m := hintDurationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	unit, ok := hintUnits[m[2]]
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(value * float64(unit)), true
+}
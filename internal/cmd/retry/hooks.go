@@ -0,0 +1,74 @@
+package retry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Hook names, also used as the flag names
+const (
+	hookBeforeRetry  = "before-retry"
+	hookAfterFailure = "after-failure"
+	hookOnExhausted  = "on-exhausted"
+)
+
+// Values accepted by --hook-failure
+const (
+	hookFailureWarn  = "warn"
+	hookFailureAbort = "abort"
+)
+
+// hookStderrLimit bounds the stderr tail passed to hooks in
+// DKIT_RETRY_STDERR
+const hookStderrLimit = 4096
+
+// hookContext describes the failed attempt a hook runs after
+type hookContext struct {
+	attempt     int // the failed attempt, or the next one for before-retry
+	maxAttempts int // 0 without a limit
+	exitCode    int
+	reason      string
+	stderr      string
+	command     string
+	session     string
+}
+
+// env returns the environment variables a hook receives
+func (c hookContext) env(name string) []string {
+	env := []string{
+		"DKIT_RETRY_HOOK=" + name,
+		fmt.Sprintf("DKIT_RETRY_ATTEMPT=%d", c.attempt),
+		fmt.Sprintf("DKIT_RETRY_MAX_ATTEMPTS=%d", c.maxAttempts),
+		fmt.Sprintf("DKIT_RETRY_EXIT_CODE=%d", c.exitCode),
+		"DKIT_RETRY_REASON=" + c.reason,
+		"DKIT_RETRY_STDERR=" + stderrTail(c.stderr, hookStderrLimit),
+		"DKIT_RETRY_COMMAND=" + c.command,
+	}
+	if c.session != "" {
+		env = append(env, "DKIT_RETRY_SESSION="+c.session)
+	}
+	return env
+}
+
+// runHookCommand runs a hook command with sh -c. Its output goes to stderr so
+// that it does not mix with the output of the retried command.
+func runHookCommand(name, command string, c hookContext, opts execOptions, log io.Writer) attemptResult {
+	opts.env = c.env(name)
+	opts.stdout = os.Stderr
+	return executeCommand([]string{command}, opts, log, log)
+}
+
+// stderrTail returns the end of s, starting at a line boundary if possible
+func stderrTail(s string, limit int) string {
+	s = strings.TrimRight(s, "\n")
+	if len(s) <= limit {
+		return s
+	}
+	s = s[len(s)-limit:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)-1 {
+		s = s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+//go:build windows
+
+package retry
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockStaleAfter is how old a lock file must be to be considered left
+// behind by a process that died while holding it
+const lockStaleAfter = 30 * time.Second
+
+// lockFile takes an exclusive lock by creating path and returns the
+// function that releases it
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(2 * lockStaleAfter)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
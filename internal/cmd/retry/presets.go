@@ -0,0 +1,313 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/delinoio/dkit/internal/utils"
+	"github.com/spf13/pflag"
+	"github.com/tailscale/hujson"
+)
+
+// retryPreset bundles retry settings for a tool. Unset fields leave the
+// flag defaults alone.
+type retryPreset struct {
+	// Extends names the preset this one is based on. A user preset with
+	// the name of a built-in preset extends it implicitly.
+	Extends string `json:"extends,omitempty"`
+
+	Description       string   `json:"description,omitempty"`
+	Attempts          *int     `json:"attempts,omitempty"`
+	Delay             string   `json:"delay,omitempty"`
+	MaxDelay          string   `json:"max_delay,omitempty"`
+	Backoff           string   `json:"backoff,omitempty"`
+	BackoffMultiplier *float64 `json:"backoff_multiplier,omitempty"`
+	Jitter            *bool    `json:"jitter,omitempty"`
+	Timeout           string   `json:"timeout,omitempty"`
+	OnExit            []int    `json:"on_exit,omitempty"`
+	SkipExit          []int    `json:"skip_exit,omitempty"`
+	OnStderr          string   `json:"on_stderr,omitempty"`
+	SkipStderr        string   `json:"skip_stderr,omitempty"`
+	OnStdout          string   `json:"on_stdout,omitempty"`
+}
+
+// retryConfig is the project configuration read from .dkit/retry.json
+// (JSONC)
+type retryConfig struct {
+	Presets map[string]retryPreset `json:"presets"`
+}
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+
+// Command not found and not executable are never worth retrying
+var skipNotRunnable = []int{126, 127}
+
+// builtinPresets are curated for the transient failures of common tools.
+// Each one only retries when stderr looks like a network or lock problem.
+var builtinPresets = map[string]retryPreset{
+	"npm": {
+		Description: "npm, yarn and pnpm registry and network errors",
+		Attempts:    intPtr(4),
+		Delay:       "2s",
+		MaxDelay:    "30s",
+		Backoff:     "exponential",
+		Jitter:      boolPtr(true),
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(ECONNRESET|ETIMEDOUT|ECONNREFUSED|EAI_AGAIN|ENOTFOUND|EPIPE|ESOCKETTIMEDOUT|ERR_SOCKET_TIMEOUT|socket hang up|network timeout|code E(429|5\d\d)|\b(429|50[234])\b.*registry)`,
+	},
+	"git": {
+		Description: "git clone, fetch and push over flaky connections",
+		Attempts:    intPtr(4),
+		Delay:       "2s",
+		MaxDelay:    "30s",
+		Backoff:     "exponential",
+		Jitter:      boolPtr(true),
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(could not resolve host|connection (timed out|reset|refused)|operation timed out|early EOF|RPC failed|remote end hung up unexpectedly|gnutls_handshake|SSL_ERROR_SYSCALL|returned error: (429|5\d\d)|index\.lock': File exists)`,
+	},
+	"go-mod": {
+		Description: "go mod download and module proxy errors",
+		Attempts:    intPtr(4),
+		Delay:       "2s",
+		MaxDelay:    "30s",
+		Backoff:     "exponential",
+		Jitter:      boolPtr(true),
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(dial tcp|i/o timeout|connection reset by peer|TLS handshake timeout|unexpected EOF|no such host|(429|50[234]) (Too Many Requests|Bad Gateway|Service Unavailable|Gateway Timeout))`,
+	},
+	"docker": {
+		Description: "docker pull and push registry errors",
+		Attempts:    intPtr(5),
+		Delay:       "5s",
+		MaxDelay:    "60s",
+		Backoff:     "exponential",
+		Jitter:      boolPtr(true),
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(TLS handshake timeout|i/o timeout|connection reset by peer|toomanyrequests|request canceled|Client\.Timeout exceeded|unexpected EOF|no such host|\b50[234]\b|Bad Gateway|Service Unavailable)`,
+	},
+	"apt": {
+		Description: "apt and dpkg lock contention and mirror errors",
+		Attempts:    intPtr(5),
+		Delay:       "5s",
+		MaxDelay:    "60s",
+		Backoff:     "linear",
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(could not get lock|unable to acquire the dpkg frontend lock|temporary failure resolving|failed to fetch|connection failed|unable to connect|could not connect|hash sum mismatch)`,
+	},
+	"network": {
+		Description: "generic connection, DNS, TLS and 429/5xx errors",
+		Attempts:    intPtr(5),
+		Delay:       "1s",
+		MaxDelay:    "30s",
+		Backoff:     "exponential",
+		Jitter:      boolPtr(true),
+		SkipExit:    skipNotRunnable,
+		OnStderr:    `(?i)(ECONNRESET|ECONNREFUSED|ETIMEDOUT|EAI_AGAIN|connection (reset|refused|timed out)|timed? ?out|temporary failure|no route to host|network is unreachable|could not resolve|name resolution|TLS handshake|unexpected EOF|\b(429|50[234])\b)`,
+	},
+}
+
+// loadRetryConfig loads .dkit/retry.json, returning an empty config if the
+// project has no config file
+func loadRetryConfig() (*retryConfig, error) {
+	config := &retryConfig{}
+
+	dataDir, err := utils.GetDkitDataDir("")
+	if err != nil {
+		return config, nil
+	}
+
+	path := filepath.Join(dataDir, "retry.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	standard, err := hujson.Standardize(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONC in %s: %w", path, err)
+	}
+	if err := json.Unmarshal(standard, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// usePreset applies --preset to opts
+func usePreset(flags *pflag.FlagSet, opts *retryOptions) error {
+	config, err := loadRetryConfig()
+	if err != nil {
+		utils.PrintError("%v", err)
+		return err
+	}
+
+	preset, err := resolvePreset(opts.preset, config.Presets)
+	if err != nil {
+		utils.PrintError("%v", err)
+		return err
+	}
+
+	applyPreset(preset, flags, opts)
+	return nil
+}
+
+// resolvePreset returns the named preset with everything it extends
+// applied. User presets take precedence over built-in ones.
+func resolvePreset(name string, user map[string]retryPreset) (retryPreset, error) {
+	return resolvePresetChain(name, user, nil)
+}
+
+func resolvePresetChain(name string, user map[string]retryPreset, seen []string) (retryPreset, error) {
+	if slices.Contains(seen, name) {
+		return retryPreset{}, fmt.Errorf("circular preset extends: %s", strings.Join(append(seen, name), " -> "))
+	}
+	seen = append(seen, name)
+
+	builtin, isBuiltin := builtinPresets[name]
+	preset, isUser := user[name]
+	switch {
+	case !isUser && !isBuiltin:
+		return retryPreset{}, fmt.Errorf("unknown preset: %s (available: %s)", name, strings.Join(presetNames(user), ", "))
+	case !isUser:
+		return builtin, nil
+	}
+
+	// A user preset is layered on what it extends, or on the built-in
+	// preset of the same name
+	var base retryPreset
+	switch {
+	case isBuiltin && (preset.Extends == "" || preset.Extends == name):
+		base = builtin
+	case preset.Extends != "":
+		var err error
+		if base, err = resolvePresetChain(preset.Extends, user, seen); err != nil {
+			return retryPreset{}, err
+		}
+	}
+
+	return mergePreset(base, preset), nil
+}
+
+// mergePreset returns base with the fields set in override replaced
+func mergePreset(base, override retryPreset) retryPreset {
+	merged := base
+	merged.Extends = ""
+	if override.Description != "" {
+		merged.Description = override.Description
+	}
+	if override.Attempts != nil {
+		merged.Attempts = override.Attempts
+	}
+	if override.Delay != "" {
+		merged.Delay = override.Delay
+	}
+	if override.MaxDelay != "" {
+		merged.MaxDelay = override.MaxDelay
+	}
+	if override.Backoff != "" {
+		merged.Backoff = override.Backoff
+	}
+	if override.BackoffMultiplier != nil {
+		merged.BackoffMultiplier = override.BackoffMultiplier
+	}
+	if override.Jitter != nil {
+		merged.Jitter = override.Jitter
+	}
+	if override.Timeout != "" {
+		merged.Timeout = override.Timeout
+	}
+	if override.OnExit != nil {
+		merged.OnExit = override.OnExit
+	}
+	if override.SkipExit != nil {
+		merged.SkipExit = override.SkipExit
+	}
+	if override.OnStderr != "" {
+		merged.OnStderr = override.OnStderr
+	}
+	if override.SkipStderr != "" {
+		merged.SkipStderr = override.SkipStderr
+	}
+	if override.OnStdout != "" {
+		merged.OnStdout = override.OnStdout
+	}
+	return merged
+}
+
+// presetNames returns the built-in and user preset names, sorted
+func presetNames(user map[string]retryPreset) []string {
+	names := []string{}
+	for name := range builtinPresets {
+		names = append(names, name)
+	}
+	for name := range user {
+		if _, ok := builtinPresets[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset copies the preset's settings into opts. Flags given on the
+// command line take precedence.
+func applyPreset(p retryPreset, flags *pflag.FlagSet, opts *retryOptions) {
+	fromPreset := func(flag string) bool {
+		return !flags.Changed(flag)
+	}
+
+	if p.Attempts != nil && fromPreset("attempts") {
+		opts.attempts = *p.Attempts
+	}
+	if p.Delay != "" && fromPreset("delay") {
+		opts.delay = p.Delay
+	}
+	if p.MaxDelay != "" && fromPreset("max-delay") {
+		opts.maxDelay = p.MaxDelay
+	}
+	if p.Backoff != "" && fromPreset("backoff") {
+		opts.backoff = p.Backoff
+	}
+	if p.BackoffMultiplier != nil && fromPreset("backoff-multiplier") {
+		opts.backoffMultiplier = *p.BackoffMultiplier
+	}
+	if p.Jitter != nil && fromPreset("jitter") {
+		opts.jitter = *p.Jitter
+	}
+	if p.Timeout != "" && fromPreset("timeout") {
+		opts.timeout = p.Timeout
+	}
+	if p.OnExit != nil && fromPreset("on-exit") {
+		opts.onExit = joinExitCodes(p.OnExit)
+	}
+	if p.SkipExit != nil && fromPreset("skip-exit") {
+		opts.skipExit = joinExitCodes(p.SkipExit)
+	}
+	if p.OnStderr != "" && fromPreset("on-stderr") {
+		opts.onStderr = p.OnStderr
+	}
+	if p.SkipStderr != "" && fromPreset("skip-stderr") {
+		opts.skipStderr = p.SkipStderr
+	}
+	if p.OnStdout != "" && fromPreset("on-stdout") {
+		opts.onStdout = p.OnStdout
+	}
+}
+
+func joinExitCodes(codes []int) string {
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = strconv.Itoa(code)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,235 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+const (
+	// defaultProbeTimeout bounds network probes when --timeout is not set
+	defaultProbeTimeout = 5 * time.Second
+
+	// maxProbeBody is how much of an HTTP response body is read
+	maxProbeBody = 1 << 20
+)
+
+// probe is a condition checked by dkit retry --until instead of running a
+// command
+type probe struct {
+	spec   string
+	kind   string // tcp, http, file, port-free or pid-exit
+	target string
+	port   int
+	pid    int
+
+	expectStatus []statusRange
+	expectBody   *regexp.Regexp
+}
+
+// statusRange is an accepted range of HTTP status codes
+type statusRange struct {
+	min, max int
+}
+
+// parseProbe parses an --until value such as tcp://localhost:5432,
+// http://localhost:3000/health, file:./build/done, port-free:3000 or
+// pid-exit:1234
+func parseProbe(spec, expectStatus, expectBody string) (*probe, error) {
+	p := &probe{spec: spec}
+
+	switch {
+	case strings.HasPrefix(spec, "tcp://"):
+		p.kind = "tcp"
+		p.target = strings.TrimPrefix(spec, "tcp://")
+		if _, _, err := net.SplitHostPort(p.target); err != nil {
+			return nil, fmt.Errorf("invalid tcp probe %q: expected tcp://host:port", spec)
+		}
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		p.kind = "http"
+		p.target = spec
+	case strings.HasPrefix(spec, "file:"):
+		p.kind = "file"
+		p.target = strings.TrimPrefix(spec, "file:")
+		if p.target == "" {
+			return nil, fmt.Errorf("invalid file probe %q: expected file:<path>", spec)
+		}
+	case strings.HasPrefix(spec, "port-free:"):
+		p.kind = "port-free"
+		port, err := utils.ValidatePort(strings.TrimPrefix(spec, "port-free:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port-free probe %q: %w", spec, err)
+		}
+		p.port = port
+	case strings.HasPrefix(spec, "pid-exit:"):
+		p.kind = "pid-exit"
+		pid, err := strconv.Atoi(strings.TrimPrefix(spec, "pid-exit:"))
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid pid-exit probe %q: expected pid-exit:<pid>", spec)
+		}
+		p.pid = pid
+	default:
+		return nil, fmt.Errorf("unknown probe %q (use tcp://, http://, https://, file:, port-free: or pid-exit:)", spec)
+	}
+
+	if p.kind != "http" && (expectStatus != "" || expectBody != "") {
+		return nil, fmt.Errorf("--expect-status and --expect-body only apply to http probes")
+	}
+
+	// Any 2xx or 3xx response counts as up by default
+	p.expectStatus = []statusRange{{200, 399}}
+	if expectStatus != "" {
+		ranges, err := parseStatusRanges(expectStatus)
+		if err != nil {
+			return nil, err
+		}
+		p.expectStatus = ranges
+	}
+
+	if expectBody != "" {
+		re, err := regexp.Compile(expectBody)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern in --expect-body: %s", expectBody)
+		}
+		p.expectBody = re
+	}
+
+	return p, nil
+}
+
+// parseStatusRanges parses a list of status codes and classes, e.g.
+// "200,204" or "2xx"
+func parseStatusRanges(s string) ([]statusRange, error) {
+	ranges := []statusRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '5' {
+			base := int(part[0]-'0') * 100
+			ranges = append(ranges, statusRange{base, base + 99})
+			continue
+		}
+
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid --expect-status: %s (use codes like 200 or classes like 2xx)", part)
+		}
+		ranges = append(ranges, statusRange{code, code})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("invalid --expect-status: %s", s)
+	}
+	return ranges, nil
+}
+
+// run checks the probe once. The outcome is written to log.
+func (p *probe) run(timeout time.Duration, log io.Writer) attemptResult {
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	body, err := p.check(timeout)
+
+	var netErr net.Error
+	result := attemptResult{stdout: body}
+	switch {
+	case err == nil:
+		fmt.Fprintf(log, "%s: ok\n", p.spec)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		fmt.Fprintf(log, "%s: %v\n", p.spec, err)
+		result.exitCode = 124
+		result.timedOut = true
+	default:
+		fmt.Fprintf(log, "%s: %v\n", p.spec, err)
+		result.exitCode = 1
+		result.probeErr = err.Error()
+	}
+	return result
+}
+
+// check returns nil if the condition holds. HTTP probes also return the
+// response body.
+func (p *probe) check(timeout time.Duration) (string, error) {
+	switch p.kind {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", p.target, timeout)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return "", nil
+
+	case "http":
+		return p.checkHTTP(timeout)
+
+	case "file":
+		if _, err := os.Stat(p.target); err != nil {
+			if os.IsNotExist(err) {
+				return "", fmt.Errorf("%s does not exist", p.target)
+			}
+			return "", err
+		}
+		return "", nil
+
+	case "port-free":
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", p.port))
+		if err != nil {
+			return "", fmt.Errorf("port %d is in use", p.port)
+		}
+		listener.Close()
+		return "", nil
+
+	case "pid-exit":
+		if processExists(p.pid) {
+			return "", fmt.Errorf("process %d is still running", p.pid)
+		}
+		return "", nil
+	}
+
+	return "", fmt.Errorf("unknown probe: %s", p.kind)
+}
+
+func (p *probe) checkHTTP(timeout time.Duration) (string, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(p.target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	body := string(data)
+
+	accepted := false
+	for _, r := range p.expectStatus {
+		if resp.StatusCode >= r.min && resp.StatusCode <= r.max {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return body, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if p.expectBody != nil && !p.expectBody.MatchString(body) {
+		return body, fmt.Errorf("body did not match --expect-body")
+	}
+
+	return body, nil
+}
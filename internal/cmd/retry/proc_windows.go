@@ -0,0 +1,58 @@
+//go:build windows
+
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// signalProcessGroup stops the command's process tree. Windows cannot
+// deliver SIGTERM or SIGINT to another console process group, so this
+// terminates it.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return killProcessGroup(cmd)
+}
+
+// killProcessGroup kills the command's process tree
+func killProcessGroup(cmd *exec.Cmd) error {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", fmt.Sprint(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+const (
+	// processQueryLimitedInformation is PROCESS_QUERY_LIMITED_INFORMATION,
+	// which is granted for processes of other users as well
+	processQueryLimitedInformation = 0x1000
+
+	// stillActive is the exit code GetExitCodeProcess reports for a
+	// running process (STILL_ACTIVE)
+	stillActive = 259
+)
+
+// processExists reports whether a process with the PID is running. A
+// process that cannot be opened for lack of access still exists.
+func processExists(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,275 @@
+package retry
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// Report formats
+const (
+	reportJSON  = "json"
+	reportJUnit = "junit"
+)
+
+// reportStderrLines is how much of an attempt's stderr goes into a JUnit
+// failure
+const reportStderrLines = 50
+
+// retryReport is the JSON summary of a retry session
+type retryReport struct {
+	ID           string                 `json:"id,omitempty"`
+	Command      string                 `json:"command"`
+	Args         []string               `json:"args"`
+	Cwd          string                 `json:"cwd"`
+	Status       string                 `json:"status"`
+	ExitCode     int                    `json:"exit_code"`
+	Flaky        bool                   `json:"flaky"`
+	StartedAt    time.Time              `json:"started_at"`
+	EndedAt      time.Time              `json:"ended_at"`
+	DurationMs   int64                  `json:"duration_ms"`
+	TotalDelayMs int64                  `json:"total_delay_ms"`
+	Attempts     []utils.ProcessAttempt `json:"attempts"`
+}
+
+// resolveReportFormat validates --report. Without it, the format follows the
+// extension of --report-file.
+func resolveReportFormat(format, file string) (string, error) {
+	switch format {
+	case reportJSON, reportJUnit:
+		return format, nil
+	case "":
+		if file == "" {
+			return "", nil
+		}
+		if strings.EqualFold(filepath.Ext(file), ".xml") {
+			return reportJUnit, nil
+		}
+		return reportJSON, nil
+	default:
+		return "", fmt.Errorf("invalid --report format: %s (use json|junit)", format)
+	}
+}
+
+// writeReport writes the session summary and returns the report path
+func writeReport(format, file string, session *retrySession, args []string, started time.Time, exitCode int) (string, error) {
+	if file == "" {
+		name := "report.json"
+		if format == reportJUnit {
+			name = "report.xml"
+		}
+		if session.persist {
+			file = filepath.Join(session.dir, name)
+		} else {
+			file = "dkit-retry-" + name
+		}
+	}
+
+	report := buildReport(session, args, started, exitCode)
+
+	var data []byte
+	var err error
+	if format == reportJUnit {
+		data, err = junitReport(report, session.projectRoot)
+	} else {
+		data, err = json.MarshalIndent(report, "", "  ")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return file, nil
+}
+
+func buildReport(session *retrySession, args []string, started time.Time, exitCode int) *retryReport {
+	ended := time.Now()
+	if session.meta.EndedAt != nil {
+		ended = *session.meta.EndedAt
+	}
+
+	report := &retryReport{
+		Command:    strings.Join(args, " "),
+		Args:       args,
+		Cwd:        session.meta.Cwd,
+		Status:     string(utils.StatusFailed),
+		ExitCode:   exitCode,
+		StartedAt:  started,
+		EndedAt:    ended,
+		DurationMs: ended.Sub(started).Milliseconds(),
+		Attempts:   session.meta.Attempts,
+	}
+	if session.persist {
+		report.ID = session.meta.ID
+	}
+	for _, a := range report.Attempts {
+		report.TotalDelayMs += a.DelayMs
+	}
+	if exitCode == 0 {
+		// Hedged copies that were stopped did not fail
+		report.Status = string(utils.StatusCompleted)
+		for _, a := range report.Attempts {
+			if a.FailureReason != "" {
+				report.Flaky = true
+			}
+		}
+	}
+
+	return report
+}
+
+// JUnit XML structures. Earlier failed attempts are reported the way
+// Maven Surefire reports reruns: as flakyFailure if the command eventually
+// passed and as rerunFailure if it did not.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name          string         `xml:"name,attr"`
+	Classname     string         `xml:"classname,attr"`
+	Time          string         `xml:"time,attr"`
+	Failure       *junitFailure  `xml:"failure,omitempty"`
+	FlakyFailures []junitFailure `xml:"flakyFailure,omitempty"`
+	RerunFailures []junitFailure `xml:"rerunFailure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitReport(report *retryReport, projectRoot string) ([]byte, error) {
+	seconds := func(ms int64) string {
+		return fmt.Sprintf("%.3f", float64(ms)/1000)
+	}
+
+	testCase := junitTestCase{
+		Name:      report.Command,
+		Classname: "dkit.retry",
+		Time:      seconds(report.DurationMs),
+	}
+
+	for i, a := range report.Attempts {
+		// Failed attempts have a reason; an attempt without an exit code was
+		// interrupted
+		if a.FailureReason == "" && a.ExitCode != nil {
+			continue
+		}
+
+		failure := junitFailure{
+			Message: fmt.Sprintf("attempt %d: %s", a.Attempt, describeAttempt(a)),
+			Type:    describeAttempt(a),
+			Body:    attemptStderrTail(projectRoot, a),
+		}
+
+		switch {
+		case i == len(report.Attempts)-1 && report.ExitCode != 0:
+			failure.Message = fmt.Sprintf("failed after %d attempts: %s", len(report.Attempts), describeAttempt(a))
+			testCase.Failure = &failure
+		case report.ExitCode == 0:
+			testCase.FlakyFailures = append(testCase.FlakyFailures, failure)
+		default:
+			testCase.RerunFailures = append(testCase.RerunFailures, failure)
+		}
+	}
+
+	failures := 0
+	if testCase.Failure != nil {
+		failures = 1
+	}
+
+	properties := []junitProperty{
+		{Name: "attempts", Value: fmt.Sprint(len(report.Attempts))},
+		{Name: "flaky", Value: fmt.Sprint(report.Flaky)},
+		{Name: "total_delay_ms", Value: fmt.Sprint(report.TotalDelayMs)},
+	}
+	if report.ID != "" {
+		properties = append(properties, junitProperty{Name: "session", Value: report.ID})
+	}
+
+	suites := junitTestSuites{
+		Name:     "dkit retry",
+		Tests:    1,
+		Failures: failures,
+		Time:     seconds(report.DurationMs),
+		Suites: []junitTestSuite{{
+			Name:       "dkit retry",
+			Tests:      1,
+			Failures:   failures,
+			Timestamp:  report.StartedAt.Format("2006-01-02T15:04:05"),
+			Time:       seconds(report.DurationMs),
+			Properties: properties,
+			Cases:      []junitTestCase{testCase},
+		}},
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// describeAttempt summarizes why an attempt failed
+func describeAttempt(a utils.ProcessAttempt) string {
+	switch {
+	case a.FailureReason != "":
+		return a.FailureReason
+	case a.TimedOut:
+		return "timed out"
+	case a.ExitCode != nil:
+		return fmt.Sprintf("exit code %d", *a.ExitCode)
+	default:
+		return "interrupted"
+	}
+}
+
+// attemptStderrTail returns the last lines of an attempt's stderr log
+func attemptStderrTail(projectRoot string, a utils.ProcessAttempt) string {
+	data, err := os.ReadFile(filepath.Join(projectRoot, a.StderrPath))
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > reportStderrLines {
+		lines = lines[len(lines)-reportStderrLines:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,15 +1,16 @@
 package retry
 
 import (
-	"context"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"os"
 	"os/exec"
 	"os/signal"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -19,186 +20,566 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// retryOptions holds the flags of dkit retry
+type retryOptions struct {
+	attempts          int
+	delay             string
+	maxDelay          string
+	backoff           string
+	backoffMultiplier float64
+	jitter            bool
+	onExit            string
+	skipExit          string
+	onStderr          string
+	skipStderr        string
+	successExit       string
+	onStdout          string
+	failStdout        string
+	successStdout     string
+	timeout           string
+	maxTotalTime      string
+	gracePeriod       string
+	verbose           bool
+	workspace         bool
+	report            string
+	reportFile        string
+	until             string
+	expectStatus      string
+	expectBody        string
+	beforeRetry       string
+	afterFailure      string
+	onExhausted       string
+	hookFailure       string
+	delayFromOutput   string
+	noDelayHints      bool
+	preset            string
+	circuit           string
+	circuitThreshold  int
+	circuitWindow     string
+	circuitCooldown   string
+	hedgeAfter        string
+	maxParallel       int
+}
+
 func NewCommand() *cobra.Command {
-	var (
-		attempts          int
-		delay             string
-		maxDelay          string
-		backoff           string
-		backoffMultiplier float64
-		jitter            bool
-		onExit            string
-		skipExit          string
-		onStderr          string
-		skipStderr        string
-		timeout           string
-		verbose           bool
-		workspace         bool
-	)
+	var opts retryOptions
 
 	cmd := &cobra.Command{
-		Use:   "retry [flags] -- <command>",
+		Use:   "retry [flags] [-- <command>]",
 		Short: "Execute commands with retry logic",
 		Long: `Execute commands with automatic retry logic, exponential backoff, and 
 failure recovery strategies.
 
-Makes flaky commands reliable and reduces manual intervention in CI/CD pipelines.`,
+Makes flaky commands reliable and reduces manual intervention in CI/CD pipelines.
+
+With --until, dkit retry waits for a condition instead of running a command:
+  tcp://localhost:5432           a TCP connection succeeds
+  http://localhost:3000/health   a 2xx/3xx response (see --expect-status, --expect-body)
+  file:./build/done              the file exists
+  port-free:3000                 nothing listens on the port
+  pid-exit:1234                  the process has exited
+
+Each session is recorded in .dkit/processes/<id>/ with the output of every
+attempt, so it shows up in the MCP process tools. Use --report to write a
+JSON or JUnit summary for CI.
+
+--preset applies curated settings for the transient failures of a tool:
+npm, git, go-mod, docker, apt or network. Presets in .dkit/retry.json can
+extend or override them; flags given on the command line always win.
+
+With --circuit, sessions that run out of attempts are counted in
+.dkit/circuits/ (sessions stopped by --skip-exit or --skip-stderr are
+not). After --circuit-threshold failures within --circuit-window the
+circuit opens and later sessions fail fast with exit code 75 until
+--circuit-cooldown has passed; then a single probe attempt decides whether
+it closes again. Use "dkit retry circuit status" and "dkit retry circuit
+reset" to manage them.
+
+With --hedge-after, an attempt that has not finished after that long gets
+another copy of the command started next to it, up to --max-parallel
+copies. The first copy to succeed wins, the others are killed right away
+(without --grace-period), and only the winner's output is written to
+stdout. Use it for idempotent commands.
+
+Hooks run with sh -c between attempts: --after-failure after each failed
+attempt, --before-retry before each retry and --on-exhausted once when
+dkit retry gives up. They receive DKIT_RETRY_ATTEMPT, DKIT_RETRY_MAX_ATTEMPTS,
+DKIT_RETRY_EXIT_CODE, DKIT_RETRY_REASON, DKIT_RETRY_STDERR (the last 4KB of
+stderr), DKIT_RETRY_COMMAND and DKIT_RETRY_SESSION. With --hook-failure
+abort, a failing hook stops the retry loop.
+
+A wait requested in the output of a failed attempt replaces the backoff
+delay, capped by --max-delay. Retry-After, X-RateLimit-Reset, messages such
+as "try again in 45s" and GitHub's secondary rate limit are recognized unless
+--no-delay-hints is set; --delay-from-output adds a regex whose first capture
+group is the delay.`,
 		DisableFlagParsing: false,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRetry(args, attempts, delay, maxDelay, backoff, backoffMultiplier,
-				jitter, onExit, skipExit, onStderr, skipStderr, timeout, verbose, workspace)
+			if opts.preset != "" {
+				if err := usePreset(cmd.Flags(), &opts); err != nil {
+					return err
+				}
+			}
+			return runRetry(args, opts)
 		},
 	}
 
-	cmd.Flags().IntVarP(&attempts, "attempts", "n", 3, "Maximum number of retry attempts")
-	cmd.Flags().StringVarP(&delay, "delay", "d", "1s", "Initial delay between retries")
-	cmd.Flags().StringVar(&maxDelay, "max-delay", "60s", "Maximum delay for exponential backoff")
-	cmd.Flags().StringVar(&backoff, "backoff", "exponential", "Backoff strategy (linear|exponential|constant)")
-	cmd.Flags().Float64Var(&backoffMultiplier, "backoff-multiplier", 2.0, "Multiplier for exponential backoff")
-	cmd.Flags().BoolVar(&jitter, "jitter", false, "Add random jitter to delays")
-	cmd.Flags().StringVar(&onExit, "on-exit", "", "Comma-separated exit codes to retry")
-	cmd.Flags().StringVar(&skipExit, "skip-exit", "", "Comma-separated exit codes to NOT retry")
-	cmd.Flags().StringVar(&onStderr, "on-stderr", "", "Retry if stderr matches regex pattern")
-	cmd.Flags().StringVar(&skipStderr, "skip-stderr", "", "Do NOT retry if stderr matches regex pattern")
-	cmd.Flags().StringVar(&timeout, "timeout", "", "Timeout for each attempt")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show detailed retry information")
-	cmd.Flags().BoolVarP(&workspace, "workspace", "w", false, "Execute in project root directory")
+	cmd.Flags().StringVar(&opts.preset, "preset", "", "Use a preset (npm|git|go-mod|docker|apt|network or one from .dkit/retry.json)")
+	cmd.Flags().IntVarP(&opts.attempts, "attempts", "n", 3, "Maximum number of retry attempts (0: until --max-total-time)")
+	cmd.Flags().StringVarP(&opts.delay, "delay", "d", "1s", "Initial delay between retries")
+	cmd.Flags().StringVar(&opts.maxDelay, "max-delay", "60s", "Maximum delay for exponential backoff")
+	cmd.Flags().StringVar(&opts.backoff, "backoff", "exponential", "Backoff strategy ("+strings.Join(backoffStrategies, "|")+")")
+	cmd.Flags().Float64Var(&opts.backoffMultiplier, "backoff-multiplier", 2.0, "Multiplier for exponential backoff")
+	cmd.Flags().BoolVar(&opts.jitter, "jitter", false, "Add random jitter to delays")
+	cmd.Flags().StringVar(&opts.onExit, "on-exit", "", "Comma-separated exit codes to retry")
+	cmd.Flags().StringVar(&opts.skipExit, "skip-exit", "", "Comma-separated exit codes to NOT retry")
+	cmd.Flags().StringVar(&opts.onStderr, "on-stderr", "", "Retry if stderr matches regex pattern")
+	cmd.Flags().StringVar(&opts.skipStderr, "skip-stderr", "", "Do NOT retry if stderr matches regex pattern")
+	cmd.Flags().StringVar(&opts.successExit, "success-exit", "", "Comma-separated exit codes that count as success (default: 0)")
+	cmd.Flags().StringVar(&opts.onStdout, "on-stdout", "", "Retry if stdout matches regex pattern")
+	cmd.Flags().StringVar(&opts.failStdout, "fail-stdout", "", "Treat the attempt as failed if stdout matches regex pattern")
+	cmd.Flags().StringVar(&opts.successStdout, "success-stdout", "", "Treat the attempt as successful only if stdout matches regex pattern")
+	cmd.Flags().StringVar(&opts.timeout, "timeout", "", "Timeout for each attempt")
+	cmd.Flags().StringVar(&opts.maxTotalTime, "max-total-time", "", "Stop starting attempts after this much time; the running attempt is cut to fit")
+	cmd.Flags().StringVar(&opts.gracePeriod, "grace-period", "10s", "Time an attempt gets to exit after SIGTERM or Ctrl-C before it is killed")
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Show detailed retry information")
+	cmd.Flags().BoolVarP(&opts.workspace, "workspace", "w", false, "Execute in project root directory")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Retry until a probe succeeds instead of running a command")
+	cmd.Flags().StringVar(&opts.expectStatus, "expect-status", "", "HTTP status codes accepted by an http probe, e.g. 200,204 or 2xx (default: 2xx,3xx)")
+	cmd.Flags().StringVar(&opts.expectBody, "expect-body", "", "Regex the body of an http probe must match")
+	cmd.Flags().StringVar(&opts.delayFromOutput, "delay-from-output", "", "Regex whose first capture group is the next delay, e.g. 'wait (\\d+)s'")
+	cmd.Flags().BoolVar(&opts.noDelayHints, "no-delay-hints", false, "Ignore Retry-After and similar hints in the output")
+	cmd.Flags().StringVar(&opts.beforeRetry, hookBeforeRetry, "", "Command to run before each retry")
+	cmd.Flags().StringVar(&opts.afterFailure, hookAfterFailure, "", "Command to run after each failed attempt")
+	cmd.Flags().StringVar(&opts.onExhausted, hookOnExhausted, "", "Command to run when no attempt succeeded")
+	cmd.Flags().StringVar(&opts.hookFailure, "hook-failure", hookFailureWarn, "What a failing hook does (warn|abort)")
+	cmd.Flags().StringVar(&opts.hedgeAfter, "hedge-after", "", "Start another copy of a slow attempt after this long")
+	cmd.Flags().IntVar(&opts.maxParallel, "max-parallel", 0, "Copies of a hedged attempt that may run at once (default 2)")
+	cmd.Flags().StringVar(&opts.circuit, "circuit", "", "Share a circuit breaker with other sessions under this name")
+	cmd.Flags().IntVar(&opts.circuitThreshold, "circuit-threshold", 3, "Failed sessions that open the circuit")
+	cmd.Flags().StringVar(&opts.circuitWindow, "circuit-window", "10m", "Window in which failed sessions are counted")
+	cmd.Flags().StringVar(&opts.circuitCooldown, "circuit-cooldown", "5m", "How long an open circuit fails fast before a probe run")
+	cmd.Flags().StringVar(&opts.report, "report", "", "Write a summary report (json|junit)")
+	cmd.Flags().StringVar(&opts.reportFile, "report-file", "", "Report file (default: report.json or report.xml in the session directory)")
+
+	cmd.AddCommand(newCircuitCommand())
 
 	return cmd
 }
 
-func runRetry(args []string, attempts int, delay, maxDelay, backoff string,
-	backoffMultiplier float64, jitter bool, onExit, skipExit, onStderr,
-	skipStderr, timeout string, verbose, workspace bool) error {
+func runRetry(args []string, opts retryOptions) error {
+	var until *probe
+	if opts.until != "" {
+		if len(args) > 0 {
+			utils.PrintError("--until cannot be combined with a command")
+			return fmt.Errorf("--until cannot be combined with a command")
+		}
 
-	if len(args) == 0 {
+		var err error
+		until, err = parseProbe(opts.until, opts.expectStatus, opts.expectBody)
+		if err != nil {
+			utils.PrintError("%v", err)
+			return err
+		}
+		args = []string{"--until", opts.until}
+	} else if len(args) == 0 {
 		utils.PrintError("No command specified")
 		return fmt.Errorf("command required")
 	}
 
 	// Parse durations
-	delayDuration, err := parseDuration(delay)
+	delayDuration, err := parseDuration(opts.delay)
 	if err != nil {
-		utils.PrintError("Invalid delay duration: %s", delay)
+		utils.PrintError("Invalid delay duration: %s", opts.delay)
 		return err
 	}
 
-	maxDelayDuration, err := parseDuration(maxDelay)
+	maxDelayDuration, err := parseDuration(opts.maxDelay)
 	if err != nil {
-		utils.PrintError("Invalid max-delay duration: %s", maxDelay)
+		utils.PrintError("Invalid max-delay duration: %s", opts.maxDelay)
 		return err
 	}
 
 	var timeoutDuration time.Duration
-	if timeout != "" {
-		timeoutDuration, err = parseDuration(timeout)
+	if opts.timeout != "" {
+		timeoutDuration, err = parseDuration(opts.timeout)
 		if err != nil {
-			utils.PrintError("Invalid timeout duration: %s", timeout)
+			utils.PrintError("Invalid timeout duration: %s", opts.timeout)
 			return err
 		}
 	}
 
-	// Parse exit codes
-	onExitCodes, err := parseExitCodes(onExit)
+	var maxTotalTime time.Duration
+	if opts.maxTotalTime != "" {
+		maxTotalTime, err = parseDuration(opts.maxTotalTime)
+		if err != nil || maxTotalTime <= 0 {
+			utils.PrintError("Invalid max-total-time duration: %s", opts.maxTotalTime)
+			return fmt.Errorf("invalid max-total-time: %s", opts.maxTotalTime)
+		}
+	}
+
+	if opts.attempts < 0 {
+		utils.PrintError("--attempts must not be negative")
+		return fmt.Errorf("invalid attempts: %d", opts.attempts)
+	}
+	if opts.attempts == 0 && maxTotalTime == 0 {
+		utils.PrintError("--attempts 0 (unlimited) requires --max-total-time")
+		return fmt.Errorf("--attempts 0 requires --max-total-time")
+	}
+
+	if !slices.Contains(backoffStrategies, opts.backoff) {
+		utils.PrintError("Invalid backoff strategy: %s (use %s)", opts.backoff, strings.Join(backoffStrategies, "|"))
+		return fmt.Errorf("invalid backoff strategy: %s", opts.backoff)
+	}
+
+	gracePeriod, err := parseDuration(opts.gracePeriod)
 	if err != nil {
-		utils.PrintError("Invalid --on-exit codes: %s", onExit)
+		utils.PrintError("Invalid grace-period duration: %s", opts.gracePeriod)
 		return err
 	}
 
-	skipExitCodes, err := parseExitCodes(skipExit)
+	if opts.hookFailure != hookFailureWarn && opts.hookFailure != hookFailureAbort {
+		utils.PrintError("Invalid --hook-failure: %s (use warn|abort)", opts.hookFailure)
+		return fmt.Errorf("invalid hook-failure: %s", opts.hookFailure)
+	}
+
+	var hedge hedgeOptions
+	if opts.hedgeAfter != "" {
+		if until != nil {
+			utils.PrintError("--hedge-after cannot be combined with --until")
+			return fmt.Errorf("--hedge-after cannot be combined with --until")
+		}
+		hedge.after, err = parseDuration(opts.hedgeAfter)
+		if err != nil || hedge.after <= 0 {
+			utils.PrintError("Invalid hedge-after duration: %s", opts.hedgeAfter)
+			return fmt.Errorf("invalid hedge-after: %s", opts.hedgeAfter)
+		}
+		hedge.maxParallel = 2
+		if opts.maxParallel != 0 {
+			hedge.maxParallel = opts.maxParallel
+		}
+		if hedge.maxParallel < 1 {
+			utils.PrintError("--max-parallel must be at least 1")
+			return fmt.Errorf("invalid max-parallel: %d", opts.maxParallel)
+		}
+	} else if opts.maxParallel != 0 {
+		utils.PrintError("--max-parallel requires --hedge-after")
+		return fmt.Errorf("--max-parallel requires --hedge-after")
+	}
+
+	rules, err := parseRetryRules(opts)
 	if err != nil {
-		utils.PrintError("Invalid --skip-exit codes: %s", skipExit)
 		return err
 	}
 
-	// Compile regex patterns
-	var onStderrRegex, skipStderrRegex *regexp.Regexp
-	if onStderr != "" {
-		onStderrRegex, err = regexp.Compile(onStderr)
+	var hints []delayHint
+	if opts.delayFromOutput != "" {
+		hint, err := newOutputDelayHint(opts.delayFromOutput)
 		if err != nil {
-			utils.PrintError("Invalid regex pattern in --on-stderr: %s", onStderr)
+			utils.PrintError("%v", err)
 			return err
 		}
+		hints = append(hints, *hint)
+	}
+	if !opts.noDelayHints {
+		hints = append(hints, builtinDelayHints...)
+	}
+
+	reportFormat, err := resolveReportFormat(opts.report, opts.reportFile)
+	if err != nil {
+		utils.PrintError("%v", err)
+		return err
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	if opts.workspace {
+		if gitRoot, err := utils.FindProjectRoot(""); err == nil {
+			workDir = gitRoot
+		}
 	}
-	if skipStderr != "" {
-		skipStderrRegex, err = regexp.Compile(skipStderr)
+
+	var circuit *circuitBreaker
+	if opts.circuit != "" {
+		circuit, err = parseCircuit(opts)
 		if err != nil {
-			utils.PrintError("Invalid regex pattern in --skip-stderr: %s", skipStderr)
+			utils.PrintError("%v", err)
 			return err
 		}
+
+		allowed, reason := circuit.allow(time.Now())
+		if !allowed {
+			utils.PrintError("%s", reason)
+			os.Exit(exitCircuitOpen)
+		}
+		if circuit.probing {
+			utils.PrintInfo("Circuit %s is half-open, running a single probe attempt", opts.circuit)
+			opts.attempts = 1
+		}
 	}
 
-	// Setup signal handling
+	// Record the session; retrying still works if .dkit is not writable
+	session, err := newRetrySession(args, workDir)
+	if err != nil {
+		utils.PrintWarning("Failed to record retry session: %v", err)
+	}
+	defer session.close()
+
+	// Setup signal handling. Attempts run in their own process group, so
+	// Ctrl-C is forwarded to them from here.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	execOpts := execOptions{
+		workDir:   workDir,
+		timeout:   timeoutDuration,
+		grace:     gracePeriod,
+		verbose:   opts.verbose,
+		interrupt: sigChan,
+	}
 
 	// Print configuration if verbose
-	if verbose {
+	if opts.verbose {
 		utils.PrintInfo("Configuration:")
-		utils.PrintInfo("  Command: %s", strings.Join(args, " "))
-		utils.PrintInfo("  Max attempts: %d", attempts)
-		utils.PrintInfo("  Backoff: %s (%.1fx, max %s)", backoff, backoffMultiplier, maxDelay)
-		if timeout != "" {
-			utils.PrintInfo("  Timeout: %s per attempt", timeout)
+		if until != nil {
+			utils.PrintInfo("  Until: %s", opts.until)
+		} else {
+			utils.PrintInfo("  Command: %s", strings.Join(args, " "))
+		}
+		if opts.attempts == 0 {
+			utils.PrintInfo("  Max attempts: unlimited")
+		} else {
+			utils.PrintInfo("  Max attempts: %d", opts.attempts)
+		}
+		if maxTotalTime > 0 {
+			utils.PrintInfo("  Max total time: %s", opts.maxTotalTime)
+		}
+		if opts.preset != "" {
+			utils.PrintInfo("  Preset: %s", opts.preset)
+		}
+		utils.PrintInfo("  Backoff: %s (%.1fx, max %s)", opts.backoff, opts.backoffMultiplier, opts.maxDelay)
+		if opts.timeout != "" {
+			utils.PrintInfo("  Timeout: %s per attempt", opts.timeout)
+		}
+		if session.persist {
+			utils.PrintInfo("  Session: %s", session.meta.ID)
 		}
 	}
 
 	startTime := time.Now()
-	var lastExitCode int
+	if maxTotalTime > 0 {
+		hedge.deadline = startTime.Add(maxTotalTime)
+	}
+	var lastExitCode, attemptsRun int
+	var lastDelay time.Duration
+	var lastResult attemptResult
+	var lastReason string
+
+	// remaining returns the time left before --max-total-time, or -1
+	// without a deadline
+	remaining := func() time.Duration {
+		if maxTotalTime == 0 {
+			return -1
+		}
+		return max(maxTotalTime-time.Since(startTime), 0)
+	}
+	deadlineReached := false
+
+	// finish records the outcome and writes the report. exhausted is set
+	// when the session failed because it ran out of attempts or time.
+	finish := func(exitCode int, exhausted bool) {
+		session.finish(exitCode)
+		if circuit != nil {
+			circuit.record(exitCode, exhausted, time.Now())
+		}
+		if reportFormat != "" {
+			path, err := writeReport(reportFormat, opts.reportFile, session, args, startTime, exitCode)
+			if err != nil {
+				utils.PrintWarning("Failed to write report: %v", err)
+			} else if opts.verbose {
+				utils.PrintInfo("Report written to %s", path)
+			}
+		}
+	}
+
+	// interrupted stops the session with the conventional exit code for
+	// SIGINT
+	interrupted := func() {
+		utils.PrintInfo("Interrupted by user")
+		finish(exitInterrupted, false)
+		session.close()
+		os.Exit(exitInterrupted)
+	}
+
+	// runHook runs a hook with the outcome of the last failed attempt. It
+	// returns false if the hook failed and --hook-failure abort is set.
+	runHook := func(name, command string, attempt int) bool {
+		if command == "" {
+			return true
+		}
+
+		if opts.verbose {
+			utils.PrintInfo("Running --%s hook: %s", name, command)
+		}
+		hookCtx := hookContext{
+			attempt:     attempt,
+			maxAttempts: opts.attempts,
+			exitCode:    lastResult.exitCode,
+			reason:      lastReason,
+			stderr:      lastResult.stderr,
+			command:     strings.Join(args, " "),
+		}
+		if session.persist {
+			hookCtx.session = session.meta.ID
+		}
+
+		hookOpts := execOpts
+		hookOpts.timeout = timeoutDuration
+		result := runHookCommand(name, command, hookCtx, hookOpts, session.beginHook(name))
+		if result.interrupted {
+			interrupted()
+		}
+		if result.exitCode == 0 {
+			return true
+		}
+
+		if opts.hookFailure == hookFailureAbort {
+			utils.PrintError("--%s hook failed with exit code %d, aborting", name, result.exitCode)
+			return false
+		}
+		utils.PrintWarning("--%s hook failed with exit code %d", name, result.exitCode)
+		return true
+	}
+	hookAborted := false
+	stoppedEarly := false // a skip rule ended the session
 
-	for attempt := 1; attempt <= attempts; attempt++ {
+	for attempt := 1; opts.attempts == 0 || attempt <= opts.attempts; attempt++ {
 		select {
 		case <-sigChan:
-			utils.PrintInfo("Interrupted by user")
-			return fmt.Errorf("interrupted")
+			interrupted()
 		default:
 		}
 
-		utils.PrintInfo("Attempt %d/%d...", attempt, attempts)
+		if attempt > 1 && !runHook(hookBeforeRetry, opts.beforeRetry, attempt) {
+			hookAborted = true
+			break
+		}
+
+		// Cut the attempt to the time left before the deadline
+		execOpts.timeout = timeoutDuration
+		if left := remaining(); left == 0 {
+			deadlineReached = true
+			break
+		} else if left > 0 && (execOpts.timeout == 0 || left < execOpts.timeout) {
+			execOpts.timeout = left
+		}
+
+		label := attemptLabel(attempt, opts.attempts)
+		utils.PrintInfo("Attempt %s...", label)
+		attemptsRun = attempt
 
 		attemptStart := time.Now()
-		exitCode, stderr := executeCommand(args, timeoutDuration, workspace, verbose)
-		attemptDuration := time.Since(attemptStart)
+		var result attemptResult
+		var success bool
+		var reason string
+		if hedge.after > 0 {
+			result, success, reason = runHedged(args, label, hedge, execOpts, rules, session, sigChan)
+			if result.interrupted {
+				interrupted()
+			}
+		} else {
+			n, stdoutLog, stderrLog := session.beginAttempt(label)
+			if until != nil {
+				result = until.run(execOpts.timeout, stdoutLog)
+			} else {
+				result = executeCommand(args, execOpts, stdoutLog, stderrLog)
+			}
+			session.endAttempt(n, result, attemptStart)
 
-		lastExitCode = exitCode
+			if result.interrupted {
+				session.recordOutcome(n, false, "interrupted")
+				interrupted()
+			}
+
+			// Check if succeeded
+			success, reason = rules.evaluate(result)
+			session.recordOutcome(n, success, reason)
+		}
+		attemptDuration := time.Since(attemptStart)
+		exitCode, stderr := result.exitCode, result.stderr
 
-		// Check if succeeded
-		if exitCode == 0 {
+		if success {
 			utils.PrintSuccess("Success!")
-			if verbose {
+			if opts.verbose {
 				utils.PrintInfo("Total time: %.1fs (%d attempts)", time.Since(startTime).Seconds(), attempt)
 			}
+			finish(0, false)
 			return nil
 		}
 
+		// A command that exited 0 but failed a stdout rule still fails
+		lastExitCode = exitCode
+		if lastExitCode == 0 {
+			lastExitCode = 1
+		}
+		lastResult, lastReason = result, reason
+
 		// Log failure
-		if verbose {
-			utils.PrintInfo("✗ Failed after %.1fs with exit code %d", attemptDuration.Seconds(), exitCode)
+		if opts.verbose {
+			utils.PrintInfo("✗ Failed after %.1fs: %s", attemptDuration.Seconds(), reason)
 			if stderr != "" {
 				utils.PrintInfo("Error output: %s", truncate(stderr, 200))
 			}
 		} else {
-			utils.PrintInfo("✗ Failed with exit code %d", exitCode)
+			utils.PrintInfo("✗ Failed: %s", reason)
+		}
+
+		if !runHook(hookAfterFailure, opts.afterFailure, attempt) {
+			hookAborted = true
+			break
 		}
 
 		// Check if we should retry
-		if attempt < attempts {
-			shouldRetry := shouldRetryCommand(exitCode, stderr, onExitCodes, skipExitCodes,
-				onStderrRegex, skipStderrRegex)
+		if opts.attempts == 0 || attempt < opts.attempts {
+			shouldRetry := shouldRetryCommand(result, rules)
 
 			if !shouldRetry {
-				if verbose {
+				if opts.verbose {
 					utils.PrintInfo("Retry condition not met, stopping")
 				}
+				stoppedEarly = true
 				break
 			}
 
 			// Calculate delay
-			waitDuration := calculateDelay(attempt, delayDuration, maxDelayDuration,
-				backoff, backoffMultiplier, jitter)
+			waitDuration := calculateDelay(attempt, lastDelay, delayDuration, maxDelayDuration,
+				opts.backoff, opts.backoffMultiplier, opts.jitter)
 
-			if verbose {
-				utils.PrintInfo("Retry condition met: exit code %d", exitCode)
+			// The command may know better how long to wait
+			if hint, name, ok := findDelayHint(hints, result, time.Now()); ok {
+				waitDuration = min(hint, maxDelayDuration)
+				if opts.verbose {
+					if hint > maxDelayDuration {
+						utils.PrintInfo("Delay hint from %s: %s (capped by --max-delay)", name, formatDuration(hint))
+					} else {
+						utils.PrintInfo("Delay hint from %s: %s", name, formatDuration(hint))
+					}
+				}
+			}
+			lastDelay = waitDuration
+
+			// No attempt can start after the deadline
+			if left := remaining(); left >= 0 && waitDuration >= left {
+				deadlineReached = true
+				break
+			}
+			session.recordDelay(waitDuration)
+
+			if opts.verbose {
+				utils.PrintInfo("Retry condition met: %s", reason)
 			}
 			utils.PrintInfo("Waiting %s before retry...", formatDuration(waitDuration))
 
@@ -206,24 +587,98 @@ func runRetry(args []string, attempts int, delay, maxDelay, backoff string,
 			select {
 			case <-time.After(waitDuration):
 			case <-sigChan:
-				utils.PrintInfo("Interrupted by user")
-				return fmt.Errorf("interrupted")
+				interrupted()
 			}
 		}
 	}
 
 	// All attempts exhausted
+	if !hookAborted {
+		runHook(hookOnExhausted, opts.onExhausted, attemptsRun)
+	}
+
 	utils.PrintInfo("")
-	utils.PrintInfo("All retry attempts exhausted")
-	utils.PrintInfo("Command failed after %d attempts", attempts)
+	if hookAborted {
+		utils.PrintInfo("Retry aborted by a failing hook")
+	} else if deadlineReached {
+		utils.PrintInfo("Max total time of %s reached", opts.maxTotalTime)
+	} else {
+		utils.PrintInfo("All retry attempts exhausted")
+	}
+	utils.PrintInfo("Command failed after %d attempts", attemptsRun)
 	utils.PrintInfo("Total time: %.1fs", time.Since(startTime).Seconds())
 	utils.PrintInfo("Last exit code: %d", lastExitCode)
 
+	finish(lastExitCode, !hookAborted && !stoppedEarly)
+	session.close()
 	os.Exit(lastExitCode)
 	return nil
 }
 
-func executeCommand(args []string, timeout time.Duration, workspace bool, verbose bool) (int, string) {
+// exitInterrupted is the exit code when dkit retry is interrupted
+const exitInterrupted = 130
+
+// maxCapturedOutput bounds how much of each stream is kept for matching
+// the output rules; longer output is matched by its tail
+const maxCapturedOutput = 4 << 20
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	limit int
+	data  []byte
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.limit; over > 0 {
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
+
+// attemptResult is the outcome of a single attempt
+type attemptResult struct {
+	exitCode    int
+	stdout      string
+	stderr      string
+	pid         int
+	timedOut    bool
+	interrupted bool
+	cancelled   bool   // a hedged copy stopped after another won
+	probeErr    string // why an --until probe failed
+}
+
+// execOptions controls how an attempt is run
+type execOptions struct {
+	workDir string
+	timeout time.Duration
+	verbose bool
+
+	// env is added to the environment of the command
+	env []string
+
+	// stdout and stderr are where the command's output is shown (default:
+	// os.Stdout and os.Stderr)
+	stdout io.Writer
+	stderr io.Writer
+
+	// grace is how long the attempt may take to exit after SIGTERM or a
+	// forwarded interrupt before it is killed
+	grace time.Duration
+
+	// interrupt delivers Ctrl-C and SIGTERM received by dkit
+	interrupt <-chan os.Signal
+}
+
+func executeCommand(args []string, opts execOptions, stdoutLog, stderrLog io.Writer) attemptResult {
 	var cmd *exec.Cmd
 
 	// Create command
@@ -232,135 +687,266 @@ func executeCommand(args []string, timeout time.Duration, workspace bool, verbos
 	} else {
 		cmd = exec.Command(args[0], args[1:]...)
 	}
-
-	// Set working directory if workspace flag is set
-	if workspace {
-		if gitRoot, err := utils.FindProjectRoot(""); err == nil {
-			cmd.Dir = gitRoot
-		}
+	cmd.Dir = opts.workDir
+	if len(opts.env) > 0 {
+		cmd.Env = append(os.Environ(), opts.env...)
 	}
 
-	// Connect stdout/stderr
-	cmd.Stdout = os.Stdout
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return 1, ""
+	// Run the attempt in its own process group so that a timeout or an
+	// interrupt reaches everything it started, not just the direct child
+	setProcessGroup(cmd)
+
+	// Stream output to the terminal and the session logs. Wait returns
+	// only after all output has been copied.
+	stdoutBuf := newTailBuffer(maxCapturedOutput)
+	stderrBuf := newTailBuffer(maxCapturedOutput)
+	terminalStdout, terminalStderr := opts.stdout, opts.stderr
+	if terminalStdout == nil {
+		terminalStdout = os.Stdout
 	}
+	if terminalStderr == nil {
+		terminalStderr = os.Stderr
+	}
+	cmd.Stdout = io.MultiWriter(terminalStdout, stdoutLog, stdoutBuf)
+	cmd.Stderr = io.MultiWriter(terminalStderr, stderrLog, stderrBuf)
+	cmd.WaitDelay = time.Second
 
 	// Start command
 	if err := cmd.Start(); err != nil {
-		if verbose {
+		if opts.verbose {
 			utils.PrintError("Failed to start command: %v", err)
 		}
-		return 127, ""
+		fmt.Fprintf(stderrLog, "failed to start command: %v\n", err)
+		return attemptResult{exitCode: 127}
 	}
 
-	// Read stderr
-	stderrBytes := make([]byte, 0, 4096)
+	result := attemptResult{pid: cmd.Process.Pid}
+
+	done := make(chan error, 1)
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderrPipe.Read(buf)
-			if n > 0 {
-				stderrBytes = append(stderrBytes, buf[:n]...)
-				os.Stderr.Write(buf[:n])
-			}
-			if err != nil {
-				break
-			}
-		}
+		done <- cmd.Wait()
 	}()
 
 	// Handle timeout
-	var timeoutErr error
-	if timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+	var timeoutChan <-chan time.Time
+	if opts.timeout > 0 {
+		timer := time.NewTimer(opts.timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
 
-		done := make(chan error, 1)
-		go func() {
-			done <- cmd.Wait()
-		}()
+	var err error
+	select {
+	case err = <-done:
+	case <-timeoutChan:
+		utils.PrintInfo("✗ Timeout after %s", formatDuration(opts.timeout))
+		stopProcess(cmd, done, syscall.SIGTERM, opts)
+		result.exitCode = 124
+		result.timedOut = true
+	case sig := <-opts.interrupt:
+		stopProcess(cmd, done, sig, opts)
+		result.exitCode = exitInterrupted
+		result.interrupted = true
+	}
 
-		select {
-		case err := <-done:
-			if err != nil {
-				if exitErr, ok := err.(*exec.ExitError); ok {
-					return exitErr.ExitCode(), string(stderrBytes)
-				}
-				return 1, string(stderrBytes)
-			}
-			return 0, string(stderrBytes)
-		case <-ctx.Done():
-			cmd.Process.Kill()
-			timeoutErr = ctx.Err()
+	result.stdout = stdoutBuf.String()
+	result.stderr = stderrBuf.String()
+	if result.timedOut || result.interrupted {
+		return result
+	}
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.exitCode = exitErr.ExitCode()
+		} else {
+			result.exitCode = 1
+		}
+	}
+	return result
+}
+
+// stopProcess sends sig to the attempt's process group and kills the group
+// if it is still running after the grace period or on another interrupt
+func stopProcess(cmd *exec.Cmd, done <-chan error, sig os.Signal, opts execOptions) {
+	if err := signalProcessGroup(cmd, sig); err != nil {
+		killProcessGroup(cmd)
+		<-done
+		return
+	}
+
+	grace := time.NewTimer(opts.grace)
+	defer grace.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-grace.C:
+		if opts.verbose {
+			utils.PrintInfo("Still running after %s, killing", formatDuration(opts.grace))
+		}
+	case <-opts.interrupt:
+	}
+
+	killProcessGroup(cmd)
+	<-done
+}
+
+// retryRules decide whether an attempt succeeded and whether a failed
+// attempt is retried
+type retryRules struct {
+	successExitCodes []int
+	failStdout       *regexp.Regexp
+	successStdout    *regexp.Regexp
+
+	onExitCodes   []int
+	skipExitCodes []int
+	onStderr      *regexp.Regexp
+	skipStderr    *regexp.Regexp
+	onStdout      *regexp.Regexp
+}
+
+// parseRetryRules parses the exit code lists and compiles the patterns
+func parseRetryRules(opts retryOptions) (*retryRules, error) {
+	rules := &retryRules{successExitCodes: []int{0}}
+
+	codes := []struct {
+		flag  string
+		value string
+		dest  *[]int
+	}{
+		{"--on-exit", opts.onExit, &rules.onExitCodes},
+		{"--skip-exit", opts.skipExit, &rules.skipExitCodes},
+		{"--success-exit", opts.successExit, &rules.successExitCodes},
+	}
+	for _, c := range codes {
+		if c.value == "" {
+			continue
 		}
+		parsed, err := parseExitCodes(c.value)
+		if err != nil {
+			utils.PrintError("Invalid %s codes: %s", c.flag, c.value)
+			return nil, err
+		}
+		*c.dest = parsed
+	}
 
-		if timeoutErr != nil {
-			utils.PrintInfo("✗ Timeout after %s", formatDuration(timeout))
-			return 124, string(stderrBytes)
+	patterns := []struct {
+		flag  string
+		value string
+		dest  **regexp.Regexp
+	}{
+		{"--on-stderr", opts.onStderr, &rules.onStderr},
+		{"--skip-stderr", opts.skipStderr, &rules.skipStderr},
+		{"--on-stdout", opts.onStdout, &rules.onStdout},
+		{"--fail-stdout", opts.failStdout, &rules.failStdout},
+		{"--success-stdout", opts.successStdout, &rules.successStdout},
+	}
+	for _, p := range patterns {
+		if p.value == "" {
+			continue
 		}
-	} else {
-		err := cmd.Wait()
+		re, err := regexp.Compile(p.value)
 		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				return exitErr.ExitCode(), string(stderrBytes)
-			}
-			return 1, string(stderrBytes)
+			utils.PrintError("Invalid regex pattern in %s: %s", p.flag, p.value)
+			return nil, err
 		}
-		return 0, string(stderrBytes)
+		*p.dest = re
 	}
 
-	return 0, string(stderrBytes)
+	return rules, nil
 }
 
-func shouldRetryCommand(exitCode int, stderr string, onExitCodes, skipExitCodes []int,
-	onStderrRegex, skipStderrRegex *regexp.Regexp) bool {
+// evaluate reports whether an attempt succeeded, with the reason it failed
+// or the exit code it succeeded with
+func (r *retryRules) evaluate(result attemptResult) (bool, string) {
+	switch {
+	case result.timedOut:
+		return false, "timed out"
+	case result.probeErr != "":
+		return false, result.probeErr
+	case !contains(r.successExitCodes, result.exitCode):
+		return false, fmt.Sprintf("exit code %d", result.exitCode)
+	case r.failStdout != nil && r.failStdout.MatchString(result.stdout):
+		return false, fmt.Sprintf("stdout matched --fail-stdout (exit code %d)", result.exitCode)
+	case r.successStdout != nil && !r.successStdout.MatchString(result.stdout):
+		return false, fmt.Sprintf("stdout did not match --success-stdout (exit code %d)", result.exitCode)
+	}
+	return true, fmt.Sprintf("exit code %d", result.exitCode)
+}
 
-	// Check skip exit codes first
-	if len(skipExitCodes) > 0 && contains(skipExitCodes, exitCode) {
+// shouldRetryCommand reports whether a failed attempt is retried. Skip
+// rules take precedence; every --on-* rule that is set must match.
+func shouldRetryCommand(result attemptResult, r *retryRules) bool {
+	// Check skip rules first
+	if contains(r.skipExitCodes, result.exitCode) {
 		return false
 	}
-
-	// Check skip stderr pattern
-	if skipStderrRegex != nil && skipStderrRegex.MatchString(stderr) {
+	if r.skipStderr != nil && r.skipStderr.MatchString(result.stderr) {
 		return false
 	}
 
-	// Check on exit codes
-	if len(onExitCodes) > 0 {
-		if !contains(onExitCodes, exitCode) {
-			return false
-		}
-	} else {
-		// Default: retry on any non-zero exit code
-		if exitCode == 0 {
-			return false
-		}
+	// Check on rules; by default any failed attempt is retried
+	if len(r.onExitCodes) > 0 && !contains(r.onExitCodes, result.exitCode) {
+		return false
 	}
-
-	// Check on stderr pattern
-	if onStderrRegex != nil {
-		if !onStderrRegex.MatchString(stderr) {
-			return false
-		}
+	if r.onStderr != nil && !r.onStderr.MatchString(result.stderr) {
+		return false
+	}
+	if r.onStdout != nil && !r.onStdout.MatchString(result.stdout) {
+		return false
 	}
 
 	return true
 }
 
-func calculateDelay(attempt int, initialDelay, maxDelay time.Duration,
+// backoffStrategies are the values accepted by --backoff
+var backoffStrategies = []string{
+	"constant",
+	"linear",
+	"exponential",
+	"fibonacci",
+	"full-jitter",
+	"decorrelated-jitter",
+}
+
+// calculateDelay returns the wait after the given attempt. prevDelay is the
+// previous wait, which decorrelated jitter grows from.
+func calculateDelay(attempt int, prevDelay, initialDelay, maxDelay time.Duration,
 	strategy string, multiplier float64, useJitter bool) time.Duration {
 
 	var delay time.Duration
 
+	// Grow in float64 and cap before converting so that long unlimited
+	// runs cannot overflow
+	capped := func(d float64) time.Duration {
+		if d >= float64(maxDelay) {
+			return maxDelay
+		}
+		return time.Duration(d)
+	}
+
 	switch strategy {
 	case "constant":
 		delay = initialDelay
 	case "linear":
-		delay = time.Duration(attempt) * initialDelay
+		delay = capped(float64(attempt) * float64(initialDelay))
 	case "exponential":
-		delay = time.Duration(float64(initialDelay) * math.Pow(multiplier, float64(attempt-1)))
+		delay = capped(float64(initialDelay) * math.Pow(multiplier, float64(attempt-1)))
+	case "fibonacci":
+		// 1, 1, 2, 3, 5, ... times the initial delay
+		a, b := 1.0, 1.0
+		for i := 1; i < attempt && a*float64(initialDelay) < float64(maxDelay); i++ {
+			a, b = b, a+b
+		}
+		delay = capped(a * float64(initialDelay))
+	case "full-jitter":
+		// Anywhere between zero and the exponential delay
+		ceiling := capped(float64(initialDelay) * math.Pow(multiplier, float64(attempt-1)))
+		delay = randomDuration(0, ceiling)
+	case "decorrelated-jitter":
+		// Between the initial delay and three times the previous delay
+		prev := max(prevDelay, initialDelay)
+		delay = randomDuration(initialDelay, capped(float64(prev)*3))
 	default:
 		delay = initialDelay
 	}
@@ -371,11 +957,9 @@ func calculateDelay(attempt int, initialDelay, maxDelay time.Duration,
 	}
 
 	// Apply jitter
-	if useJitter {
-		jitterAmount := float64(delay) * 0.2 // ±20% jitter
-		randomJitter, _ := rand.Int(rand.Reader, big.NewInt(int64(jitterAmount*2)))
-		jitterDelta := time.Duration(randomJitter.Int64()) - time.Duration(jitterAmount)
-		delay += jitterDelta
+	if useJitter && delay > 0 {
+		jitterAmount := delay / 5 // ±20% jitter
+		delay += randomDuration(-jitterAmount, jitterAmount)
 
 		// Ensure delay is positive
 		if delay < 0 {
@@ -386,6 +970,26 @@ func calculateDelay(attempt int, initialDelay, maxDelay time.Duration,
 	return delay
 }
 
+// randomDuration returns a random duration in [lo, hi]
+func randomDuration(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi-lo)+1))
+	if err != nil {
+		return lo
+	}
+	return lo + time.Duration(n.Int64())
+}
+
+// attemptLabel formats an attempt number as "2/5", or "2" without a limit
+func attemptLabel(attempt, attempts int) string {
+	if attempts == 0 {
+		return fmt.Sprint(attempt)
+	}
+	return fmt.Sprintf("%d/%d", attempt, attempts)
+}
+
 func parseDuration(s string) (time.Duration, error) {
 	return time.ParseDuration(s)
 }
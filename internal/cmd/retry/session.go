@@ -0,0 +1,226 @@
+package retry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// retrySession records a dkit retry run in the process registry. The
+// session logs combine the output of every attempt; each attempt also has
+// its own logs under attempts/<n>/.
+type retrySession struct {
+	projectRoot string
+	dir         string
+	meta        utils.ProcessMetadata
+
+	// persist is false if the session could not be recorded; attempts are
+	// still tracked for the report
+	persist bool
+
+	stdoutLog *os.File
+	stderrLog *os.File
+
+	// attemptLogs are the open logs of running attempts. Hedged attempts
+	// run side by side, so there can be more than one.
+	attemptLogs map[int]*attemptLogFiles
+}
+
+// attemptLogFiles are the logs of a single attempt
+type attemptLogFiles struct {
+	stdout *os.File
+	stderr *os.File
+}
+
+// newRetrySession registers a new session. If it cannot be recorded, the
+// returned session only tracks attempts in memory.
+func newRetrySession(args []string, workDir string) (*retrySession, error) {
+	id := utils.GenerateProcessID()
+	s := &retrySession{
+		attemptLogs: map[int]*attemptLogFiles{},
+		meta: utils.ProcessMetadata{
+			ID:         id,
+			PID:        os.Getpid(),
+			Command:    strings.Join(args, " "),
+			Args:       args,
+			Cwd:        workDir,
+			StartedAt:  time.Now(),
+			Status:     utils.StatusRunning,
+			StdoutPath: fmt.Sprintf(".dkit/processes/%s/stdout.log", id),
+			StderrPath: fmt.Sprintf(".dkit/processes/%s/stderr.log", id),
+			Kind:       utils.ProcessKindRetry,
+			Attempts:   []utils.ProcessAttempt{},
+		},
+	}
+
+	projectRoot, err := utils.FindProjectRoot("")
+	if err != nil {
+		projectRoot = workDir
+	}
+	s.projectRoot = projectRoot
+
+	dataDir, err := utils.EnsureDkitDataDir(projectRoot)
+	if err != nil {
+		return s, fmt.Errorf("failed to create .dkit directory: %w", err)
+	}
+
+	s.dir = filepath.Join(dataDir, "processes", id)
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return s, fmt.Errorf("failed to create process directory: %w", err)
+	}
+
+	if s.stdoutLog, err = os.Create(filepath.Join(s.dir, "stdout.log")); err != nil {
+		return s, fmt.Errorf("failed to create stdout log: %w", err)
+	}
+	if s.stderrLog, err = os.Create(filepath.Join(s.dir, "stderr.log")); err != nil {
+		s.stdoutLog.Close()
+		return s, fmt.Errorf("failed to create stderr log: %w", err)
+	}
+
+	if err := utils.SaveProcessMetadata(projectRoot, s.meta); err != nil {
+		s.stdoutLog.Close()
+		s.stderrLog.Close()
+		return s, err
+	}
+
+	s.persist = true
+	return s, nil
+}
+
+// beginAttempt opens the logs of an attempt and returns its number and the
+// writers for its stdout and stderr
+func (s *retrySession) beginAttempt(label string) (int, io.Writer, io.Writer) {
+	attempt := len(s.meta.Attempts) + 1
+	s.meta.Attempts = append(s.meta.Attempts, utils.ProcessAttempt{
+		Attempt:    attempt,
+		StartedAt:  time.Now(),
+		StdoutPath: fmt.Sprintf(".dkit/processes/%s/attempts/%d/stdout.log", s.meta.ID, attempt),
+		StderrPath: fmt.Sprintf(".dkit/processes/%s/attempts/%d/stderr.log", s.meta.ID, attempt),
+	})
+
+	if !s.persist {
+		return attempt, io.Discard, io.Discard
+	}
+
+	// Mark where each attempt starts in the combined logs
+	header := fmt.Sprintf("[dkit] attempt %s\n", label)
+	s.stdoutLog.WriteString(header)
+	s.stderrLog.WriteString(header)
+
+	attemptDir := filepath.Join(s.dir, "attempts", fmt.Sprint(attempt))
+	if err := os.MkdirAll(attemptDir, 0755); err != nil {
+		utils.PrintWarning("Failed to create attempt directory: %v", err)
+		return attempt, s.stdoutLog, s.stderrLog
+	}
+
+	stdout, err := os.Create(filepath.Join(attemptDir, "stdout.log"))
+	if err != nil {
+		utils.PrintWarning("Failed to create attempt log: %v", err)
+		return attempt, s.stdoutLog, s.stderrLog
+	}
+	stderr, err := os.Create(filepath.Join(attemptDir, "stderr.log"))
+	if err != nil {
+		stdout.Close()
+		utils.PrintWarning("Failed to create attempt log: %v", err)
+		return attempt, s.stdoutLog, s.stderrLog
+	}
+	s.attemptLogs[attempt] = &attemptLogFiles{stdout: stdout, stderr: stderr}
+
+	return attempt, io.MultiWriter(s.stdoutLog, stdout), io.MultiWriter(s.stderrLog, stderr)
+}
+
+// beginHook marks the start of a hook in the session logs and returns the
+// writer for its output
+func (s *retrySession) beginHook(name string) io.Writer {
+	if !s.persist {
+		return io.Discard
+	}
+	s.stderrLog.WriteString(fmt.Sprintf("[dkit] hook %s\n", name))
+	return s.stderrLog
+}
+
+// endAttempt records the outcome of an attempt
+func (s *retrySession) endAttempt(attempt int, result attemptResult, started time.Time) {
+	ended := time.Now()
+	exitCode := result.exitCode
+
+	current := &s.meta.Attempts[attempt-1]
+	current.PID = result.pid
+	current.EndedAt = &ended
+	current.DurationMs = ended.Sub(started).Milliseconds()
+	current.ExitCode = &exitCode
+	current.TimedOut = result.timedOut
+	current.Cancelled = result.cancelled
+
+	s.closeAttemptLogs(attempt)
+	s.save()
+}
+
+// recordOutcome records why an attempt failed
+func (s *retrySession) recordOutcome(attempt int, success bool, reason string) {
+	if success {
+		return
+	}
+	s.meta.Attempts[attempt-1].FailureReason = reason
+	s.save()
+}
+
+// recordDelay records the wait before the next attempt
+func (s *retrySession) recordDelay(d time.Duration) {
+	if len(s.meta.Attempts) == 0 {
+		return
+	}
+	s.meta.Attempts[len(s.meta.Attempts)-1].DelayMs = d.Milliseconds()
+	s.save()
+}
+
+// finish marks the session as completed or failed
+func (s *retrySession) finish(exitCode int) {
+	ended := time.Now()
+	s.meta.EndedAt = &ended
+	s.meta.ExitCode = &exitCode
+	if exitCode == 0 {
+		s.meta.Status = utils.StatusCompleted
+	} else {
+		s.meta.Status = utils.StatusFailed
+	}
+	s.save()
+}
+
+// close closes the session logs. It is safe to call more than once.
+func (s *retrySession) close() {
+	for attempt := range s.attemptLogs {
+		s.closeAttemptLogs(attempt)
+	}
+	if s.stdoutLog != nil {
+		s.stdoutLog.Close()
+		s.stdoutLog = nil
+	}
+	if s.stderrLog != nil {
+		s.stderrLog.Close()
+		s.stderrLog = nil
+	}
+}
+
+func (s *retrySession) closeAttemptLogs(attempt int) {
+	if logs, ok := s.attemptLogs[attempt]; ok {
+		logs.stdout.Close()
+		logs.stderr.Close()
+		delete(s.attemptLogs, attempt)
+	}
+}
+
+// save writes the session metadata to the registry
+func (s *retrySession) save() {
+	if !s.persist {
+		return
+	}
+	if err := utils.SaveProcessMetadata(s.projectRoot, s.meta); err != nil {
+		utils.PrintWarning("Failed to save retry session: %v", err)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/delinoio/dkit/internal/cmd/audit"
 	"github.com/delinoio/dkit/internal/cmd/clipboard"
 	"github.com/delinoio/dkit/internal/cmd/cron"
 	"github.com/delinoio/dkit/internal/cmd/env"
 	"github.com/delinoio/dkit/internal/cmd/git"
 	"github.com/delinoio/dkit/internal/cmd/jsonc"
+	"github.com/delinoio/dkit/internal/cmd/logs"
 	"github.com/delinoio/dkit/internal/cmd/mcp"
 	"github.com/delinoio/dkit/internal/cmd/port"
 	"github.com/delinoio/dkit/internal/cmd/retry"
@@ -33,11 +35,13 @@ func Execute() error {
 
 func init() {
 	// Add all subcommands
+	rootCmd.AddCommand(audit.NewCommand())
 	rootCmd.AddCommand(clipboard.NewCommand())
 	rootCmd.AddCommand(cron.NewCommand())
 	rootCmd.AddCommand(env.NewCommand())
 	rootCmd.AddCommand(git.NewCommand())
 	rootCmd.AddCommand(jsonc.NewCommand())
+	rootCmd.AddCommand(logs.NewCommand())
 	rootCmd.AddCommand(mcp.NewCommand())
 	rootCmd.AddCommand(port.NewCommand())
 	rootCmd.AddCommand(retry.NewCommand())
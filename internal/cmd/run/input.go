@@ -0,0 +1,52 @@
+package run
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+// inputSignals maps signal names accepted on the input channel
+var inputSignals = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// forwardInput reads input messages from the FIFO and applies them to the
+// running command: data is written to its stdin, signals are delivered to
+// the process and EOF closes stdin. Every message is appended to the input
+// log so it can be audited later. It returns when the FIFO is closed.
+func forwardInput(fifo io.Reader, stdin io.WriteCloser, process *os.Process, inputLog io.Writer) {
+	reader := bufio.NewReader(fifo)
+	logEncoder := json.NewEncoder(inputLog)
+	stdinClosed := false
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var input utils.ProcessInput
+			if json.Unmarshal(line, &input) == nil {
+				logEncoder.Encode(input)
+
+				if input.Data != "" && !stdinClosed {
+					stdin.Write([]byte(input.Data))
+				}
+				if sig, ok := inputSignals[input.Signal]; ok {
+					process.Signal(sig)
+				}
+				if input.EOF && !stdinClosed {
+					stdin.Close()
+					stdinClosed = true
+				}
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
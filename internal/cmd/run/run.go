@@ -20,6 +20,7 @@ func NewCommand() *cobra.Command {
 	var (
 		workspace      bool
 		ignoreLocalBin bool
+		inputFIFO      bool
 	)
 
 	cmd := &cobra.Command{
@@ -42,7 +43,7 @@ Features:
 				return fmt.Errorf("no command specified")
 			}
 
-			err := runCommand(args, workspace, ignoreLocalBin)
+			err := runCommand(args, workspace, ignoreLocalBin, inputFIFO)
 			if err != nil {
 				// If it's an exit error, exit with the same code
 				if exitError, ok := err.(*exec.ExitError); ok {
@@ -57,11 +58,12 @@ Features:
 
 	cmd.Flags().BoolVarP(&workspace, "workspace", "w", false, "Execute in project root directory")
 	cmd.Flags().BoolVar(&ignoreLocalBin, "ignore-local-bin", false, "Skip adding <project-root>/bin to PATH")
+	cmd.Flags().BoolVar(&inputFIFO, "input-fifo", false, "Read stdin from a FIFO in the process directory instead of the terminal (for background runs)")
 
 	return cmd
 }
 
-func runCommand(args []string, workspace, ignoreLocalBin bool) error {
+func runCommand(args []string, workspace, ignoreLocalBin, inputFIFO bool) error {
 	// Parse environment variables and command
 	envVars, cmdArgs := parseEnvAndArgs(args)
 
@@ -113,6 +115,18 @@ func runCommand(args []string, workspace, ignoreLocalBin bool) error {
 	}
 	defer stderrFile.Close()
 
+	stdoutTimestamps, err := os.Create(filepath.Join(processDir, "stdout.timestamps"))
+	if err != nil {
+		return fmt.Errorf("failed to create stdout timestamps: %w", err)
+	}
+	defer stdoutTimestamps.Close()
+
+	stderrTimestamps, err := os.Create(filepath.Join(processDir, "stderr.timestamps"))
+	if err != nil {
+		return fmt.Errorf("failed to create stderr timestamps: %w", err)
+	}
+	defer stderrTimestamps.Close()
+
 	// Build command
 	var cmdExec *exec.Cmd
 	if len(cmdArgs) == 1 {
@@ -145,9 +159,43 @@ func runCommand(args []string, workspace, ignoreLocalBin bool) error {
 
 	// Setup stdin/stdout/stderr with TTY support
 	// Use MultiWriter to write to both terminal and log files
-	cmdExec.Stdin = os.Stdin
-	cmdExec.Stdout = io.MultiWriter(os.Stdout, stdoutFile)
-	cmdExec.Stderr = io.MultiWriter(os.Stderr, stderrFile)
+	var (
+		inputFile    *os.File
+		inputLog     *os.File
+		stdinPipe    io.WriteCloser
+		fifoPath     = filepath.Join(processDir, utils.InputFIFOName)
+		inputRelPath string
+	)
+	if inputFIFO {
+		// Input comes from a FIFO so agents can answer prompts of
+		// background runs that are detached from any terminal
+		if err := utils.CreateInputFIFO(fifoPath); err != nil {
+			return err
+		}
+		defer os.Remove(fifoPath)
+
+		inputFile, err = utils.OpenInputFIFO(fifoPath)
+		if err != nil {
+			return err
+		}
+		defer inputFile.Close()
+
+		inputLog, err = os.Create(filepath.Join(processDir, utils.InputLogName))
+		if err != nil {
+			return fmt.Errorf("failed to create input log: %w", err)
+		}
+		defer inputLog.Close()
+
+		stdinPipe, err = cmdExec.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("failed to create stdin pipe: %w", err)
+		}
+		inputRelPath = fmt.Sprintf(".dkit/processes/%s/%s", processID, utils.InputFIFOName)
+	} else {
+		cmdExec.Stdin = os.Stdin
+	}
+	cmdExec.Stdout = io.MultiWriter(os.Stdout, stdoutFile, newLineTimestampWriter(stdoutTimestamps))
+	cmdExec.Stderr = io.MultiWriter(os.Stderr, stderrFile, newLineTimestampWriter(stderrTimestamps))
 
 	// Create metadata
 	startTime := time.Now()
@@ -164,6 +212,7 @@ func runCommand(args []string, workspace, ignoreLocalBin bool) error {
 		Status:     utils.StatusRunning,
 		StdoutPath: fmt.Sprintf(".dkit/processes/%s/stdout.log", processID),
 		StderrPath: fmt.Sprintf(".dkit/processes/%s/stderr.log", processID),
+		InputPath:  inputRelPath,
 	}
 
 	// Start the command
@@ -182,6 +231,10 @@ func runCommand(args []string, workspace, ignoreLocalBin bool) error {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 
+	if inputFile != nil {
+		go forwardInput(inputFile, stdinPipe, cmdExec.Process, inputLog)
+	}
+
 	// Update metadata with PID
 	meta.PID = cmdExec.Process.Pid
 	if err := utils.SaveProcessMetadata(projectRoot, meta); err != nil {
@@ -229,6 +282,13 @@ func runCommand(args []string, workspace, ignoreLocalBin bool) error {
 		meta.ExitCode = &exitCode
 	}
 
+	// Record test results if the command ran a known test framework
+	if results := parseTestResults(stdoutPath, stderrPath); results != nil {
+		if err := utils.SaveTestResults(projectRoot, processID, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save test results: %v\n", err)
+		}
+	}
+
 	if err := utils.SaveProcessMetadata(projectRoot, meta); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to save process metadata: %v\n", err)
 	}
@@ -0,0 +1,689 @@
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/delinoio/dkit/internal/utils"
+)
+
+const (
+	// maxTestLogBytes skips test result parsing for very large logs
+	maxTestLogBytes = 64 << 20
+
+	// maxTestMessageBytes bounds the failure message stored per test
+	maxTestMessageBytes = 4096
+
+	// maxTestMessageLines bounds how many lines a failure block may span
+	maxTestMessageLines = 200
+)
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// testParser recognizes the output of one test framework. parse returns
+// nil if the output does not come from that framework. Parsers set the
+// counts only when the framework prints a summary; otherwise they are
+// derived from the test cases.
+type testParser struct {
+	framework string
+	parse     func(lines []string) *utils.TestResults
+}
+
+// testParsers are tried in order, most specific first
+var testParsers = []testParser{
+	{"go", parseGoTestJSON},
+	{"go", parseGoTest},
+	{"cargo", parseCargoTest},
+	{"pytest", parsePytest},
+	{"vitest", parseVitest},
+	{"jest", parseJest},
+}
+
+// parseTestResults looks for test framework output in the given logs
+func parseTestResults(logPaths ...string) *utils.TestResults {
+	streams := [][]string{}
+	for _, path := range logPaths {
+		if lines, err := readTestLog(path); err == nil && len(lines) > 0 {
+			streams = append(streams, lines)
+		}
+	}
+
+	for _, parser := range testParsers {
+		for _, lines := range streams {
+			results := parser.parse(lines)
+			if results == nil || (len(results.Tests) == 0 && results.Passed+results.Failed+results.Skipped == 0) {
+				continue
+			}
+			results.Framework = parser.framework
+			finalizeTestResults(results)
+			return results
+		}
+	}
+
+	return nil
+}
+
+// readTestLog reads a log as lines without ANSI escapes
+func readTestLog(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxTestLogBytes {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text := ansiPattern.ReplaceAllString(string(data), "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n"), nil
+}
+
+// finalizeTestResults fills in missing counts and trims failure messages
+func finalizeTestResults(r *utils.TestResults) {
+	if r.Tests == nil {
+		r.Tests = []utils.TestCase{}
+	}
+
+	if r.Passed+r.Failed+r.Skipped == 0 {
+		for _, t := range r.Tests {
+			switch t.Status {
+			case utils.TestPassed:
+				r.Passed++
+			case utils.TestFailed:
+				r.Failed++
+			case utils.TestSkipped:
+				r.Skipped++
+			}
+		}
+	}
+
+	for i := range r.Tests {
+		msg := strings.TrimSpace(r.Tests[i].Message)
+		if len(msg) > maxTestMessageBytes {
+			msg = msg[:maxTestMessageBytes] + "\n... (truncated)"
+		}
+		r.Tests[i].Message = msg
+	}
+}
+
+// collectBlock joins the lines after start until stop returns true
+func collectBlock(lines []string, start int, stop func(string) bool) string {
+	block := []string{}
+	for i := start + 1; i < len(lines) && len(block) < maxTestMessageLines; i++ {
+		if stop(lines[i]) {
+			break
+		}
+		block = append(block, lines[i])
+	}
+	return strings.TrimSpace(strings.Join(block, "\n"))
+}
+
+var summaryCountPattern = regexp.MustCompile(`(\d+) ([a-z]+)`)
+
+// parseSummaryCounts parses summaries such as "1 failed, 2 passed" into the
+// counts of r, mapping framework-specific words to passed/failed/skipped
+func parseSummaryCounts(r *utils.TestResults, summary string) {
+	for _, m := range summaryCountPattern.FindAllStringSubmatch(summary, -1) {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "passed", "xpassed":
+			r.Passed += n
+		case "failed", "error", "errors":
+			r.Failed += n
+		case "skipped", "xfailed", "ignored", "todo", "pending":
+			r.Skipped += n
+		}
+	}
+}
+
+func secondsToMs(s string) int64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return int64(f * 1000)
+}
+
+func durationToMs(value, unit string) int64 {
+	if unit == "s" {
+		return secondsToMs(value)
+	}
+	f, _ := strconv.ParseFloat(value, 64)
+	return int64(f)
+}
+
+// findTest returns the index of the test in suite whose name matches name
+// exactly or as its last component, or -1
+func findTest(tests []utils.TestCase, suite, name, sep string) int {
+	for i, t := range tests {
+		if suite != "" && t.Suite != "" && t.Suite != suite {
+			continue
+		}
+		if t.Name == name || strings.HasSuffix(name, sep+t.Name) || strings.HasSuffix(t.Name, sep+name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// go test -json
+
+type goTestEvent struct {
+	Action      string  `json:"Action"`
+	Package     string  `json:"Package"`
+	ImportPath  string  `json:"ImportPath"`
+	Test        string  `json:"Test"`
+	Elapsed     float64 `json:"Elapsed"`
+	Output      string  `json:"Output"`
+	FailedBuild string  `json:"FailedBuild"`
+}
+
+func parseGoTestJSON(lines []string) *utils.TestResults {
+	r := &utils.TestResults{}
+	found := false
+	outputs := map[string]*strings.Builder{}
+	testsPerPackage := map[string]int{}
+
+	output := func(key string) *strings.Builder {
+		if outputs[key] == nil {
+			outputs[key] = &strings.Builder{}
+		}
+		return outputs[key]
+	}
+
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var e goTestEvent
+		if json.Unmarshal([]byte(line), &e) != nil || e.Action == "" {
+			continue
+		}
+		found = true
+
+		switch e.Action {
+		case "output":
+			output(e.Package + " " + e.Test).WriteString(e.Output)
+		case "build-output":
+			output("build " + e.ImportPath).WriteString(e.Output)
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				// A package that failed without failing a test did not build
+				// or crashed outside of a test
+				if e.Action == "fail" && testsPerPackage[e.Package] == 0 {
+					message := output(e.Package + " ").String()
+					if e.FailedBuild != "" {
+						message = output("build "+e.FailedBuild).String() + message
+					}
+					r.Tests = append(r.Tests, utils.TestCase{
+						Name:       "(package)",
+						Suite:      e.Package,
+						Status:     utils.TestFailed,
+						DurationMs: int64(e.Elapsed * 1000),
+						Message:    goFailureMessage(message),
+					})
+				}
+				r.DurationMs += int64(e.Elapsed * 1000)
+				continue
+			}
+
+			testsPerPackage[e.Package]++
+			tc := utils.TestCase{
+				Name:       e.Test,
+				Suite:      e.Package,
+				Status:     goTestStatus(e.Action),
+				DurationMs: int64(e.Elapsed * 1000),
+			}
+			if e.Action == "fail" {
+				tc.Message = goFailureMessage(output(e.Package + " " + e.Test).String())
+			}
+			r.Tests = append(r.Tests, tc)
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return r
+}
+
+func goTestStatus(action string) string {
+	switch action {
+	case "pass", "PASS":
+		return utils.TestPassed
+	case "skip", "SKIP":
+		return utils.TestSkipped
+	default:
+		return utils.TestFailed
+	}
+}
+
+// goFailureMessage drops the framing lines go test adds around test output
+func goFailureMessage(output string) string {
+	kept := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- PASS") ||
+			strings.HasPrefix(trimmed, "--- FAIL") || strings.HasPrefix(trimmed, "--- SKIP") ||
+			trimmed == "FAIL" || trimmed == "PASS" {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// go test (verbose or plain)
+
+var (
+	goResultPattern      = regexp.MustCompile(`^(\s*)--- (PASS|FAIL|SKIP): (\S+) \(([\d.]+)s\)$`)
+	goPackageLinePattern = regexp.MustCompile(`^(ok|FAIL)\s+(\S+)\s+(?:([\d.]+)s|\(cached\)|\[(.+)\])`)
+	goBuildHeaderPattern = regexp.MustCompile(`^# (\S+)`)
+	goRunPattern         = regexp.MustCompile(`^=== (?:RUN|CONT|NAME)\s+(\S+)$`)
+)
+
+// parseGoTest parses go test output without -json. Without -v only failed
+// tests are listed, so passing packages are recorded as "(package)" cases.
+func parseGoTest(lines []string) *utils.TestResults {
+	r := &utils.TestResults{}
+	found := false
+	pending := 0
+	buildErrors := map[string]string{}
+	// With -v, test output is printed under "=== RUN" before the result
+	outputs := map[string][]string{}
+	current := ""
+
+	for i, line := range lines {
+		if m := goRunPattern.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			continue
+		}
+		if current != "" && strings.HasPrefix(line, "    ") && !goResultPattern.MatchString(line) {
+			outputs[current] = append(outputs[current], strings.TrimPrefix(line, "    "))
+			continue
+		}
+		current = ""
+
+		if m := goBuildHeaderPattern.FindStringSubmatch(line); m != nil {
+			buildErrors[m[1]] = collectBlock(lines, i, func(l string) bool {
+				return goPackageLinePattern.MatchString(l) || strings.HasPrefix(l, "#") ||
+					strings.HasPrefix(l, "=== ") || strings.HasPrefix(l, "--- ") || strings.HasPrefix(l, "?")
+			})
+			continue
+		}
+
+		if m := goResultPattern.FindStringSubmatch(line); m != nil {
+			found = true
+			tc := utils.TestCase{
+				Name:       m[3],
+				Status:     goTestStatus(m[2]),
+				DurationMs: secondsToMs(m[4]),
+			}
+			if m[2] == "FAIL" {
+				// Test output follows, indented one level deeper
+				indent := m[1] + "    "
+				tc.Message = collectBlock(lines, i, func(l string) bool {
+					return !strings.HasPrefix(l, indent) || goResultPattern.MatchString(l)
+				})
+				if tc.Message == "" {
+					tc.Message = strings.Join(outputs[m[3]], "\n")
+				}
+			}
+			r.Tests = append(r.Tests, tc)
+			continue
+		}
+
+		if m := goPackageLinePattern.FindStringSubmatch(line); m != nil {
+			found = true
+			pkg := m[2]
+			for j := pending; j < len(r.Tests); j++ {
+				r.Tests[j].Suite = pkg
+			}
+			if pending == len(r.Tests) {
+				tc := utils.TestCase{
+					Name:       "(package)",
+					Suite:      pkg,
+					Status:     goTestStatus(m[1]),
+					DurationMs: secondsToMs(m[3]),
+				}
+				if m[1] == "FAIL" {
+					tc.Message = buildErrors[pkg]
+					if tc.Message == "" {
+						tc.Message = m[4]
+					}
+				}
+				r.Tests = append(r.Tests, tc)
+			}
+			r.DurationMs += secondsToMs(m[3])
+			pending = len(r.Tests)
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return r
+}
+
+// cargo test
+
+var (
+	cargoRunningPattern = regexp.MustCompile(`^\s*(?:Running (?:unittests )?(\S+)|Doc-tests (\S+))`)
+	cargoTestPattern    = regexp.MustCompile(`^test (\S+)(?: - .+)? \.\.\. (ok|FAILED|ignored)`)
+	cargoFailurePattern = regexp.MustCompile(`^---- (\S+)(?: - .+)? stdout ----$`)
+	cargoSummaryPattern = regexp.MustCompile(`^test result: (?:ok|FAILED)\. (\d+) passed; (\d+) failed; (\d+) ignored;.*?(?:finished in ([\d.]+)s)?$`)
+)
+
+func parseCargoTest(lines []string) *utils.TestResults {
+	r := &utils.TestResults{}
+	found := false
+	suite := ""
+	messages := map[string]string{}
+	counts := utils.TestResults{}
+
+	for i, line := range lines {
+		if m := cargoRunningPattern.FindStringSubmatch(line); m != nil {
+			suite = m[1]
+			if m[2] != "" {
+				suite = "doc-tests " + m[2]
+			}
+			continue
+		}
+
+		if m := cargoTestPattern.FindStringSubmatch(line); m != nil {
+			found = true
+			status := utils.TestPassed
+			switch m[2] {
+			case "FAILED":
+				status = utils.TestFailed
+			case "ignored":
+				status = utils.TestSkipped
+			}
+			r.Tests = append(r.Tests, utils.TestCase{Name: m[1], Suite: suite, Status: status})
+			continue
+		}
+
+		if m := cargoFailurePattern.FindStringSubmatch(line); m != nil {
+			messages[suite+" "+m[1]] = collectBlock(lines, i, func(l string) bool {
+				return strings.HasPrefix(l, "---- ") || l == "failures:" || strings.HasPrefix(l, "test result:")
+			})
+			continue
+		}
+
+		if m := cargoSummaryPattern.FindStringSubmatch(line); m != nil {
+			found = true
+			passed, _ := strconv.Atoi(m[1])
+			failed, _ := strconv.Atoi(m[2])
+			ignored, _ := strconv.Atoi(m[3])
+			counts.Passed += passed
+			counts.Failed += failed
+			counts.Skipped += ignored
+			r.DurationMs += secondsToMs(m[4])
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	for i := range r.Tests {
+		r.Tests[i].Message = messages[r.Tests[i].Suite+" "+r.Tests[i].Name]
+	}
+	r.Passed, r.Failed, r.Skipped = counts.Passed, counts.Failed, counts.Skipped
+	return r
+}
+
+// pytest
+
+var (
+	pytestSessionPattern = regexp.MustCompile(`^=+ test session starts =+$`)
+	pytestVerbosePattern = regexp.MustCompile(`^(\S+?\.py)::(\S+)\s+(PASSED|FAILED|SKIPPED|ERROR|XFAIL|XPASS)\b`)
+	pytestShortPattern   = regexp.MustCompile(`^(FAILED|ERROR) (\S+?\.py)::(\S+?)(?: - (.*))?$`)
+	pytestBlockPattern   = regexp.MustCompile(`^_{3,} (.+?) _{3,}$`)
+	pytestSectionPattern = regexp.MustCompile(`^=+ .* =+$`)
+	pytestSummaryPattern = regexp.MustCompile(`^=+ (.*?) in ([\d.]+)s\b.*=+$`)
+)
+
+func parsePytest(lines []string) *utils.TestResults {
+	r := &utils.TestResults{}
+	found := false
+	blocks := map[string]string{}
+
+	for i, line := range lines {
+		if pytestSessionPattern.MatchString(line) {
+			found = true
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		if m := pytestVerbosePattern.FindStringSubmatch(line); m != nil {
+			r.Tests = append(r.Tests, utils.TestCase{
+				Name:   m[2],
+				Suite:  m[1],
+				Status: pytestStatus(m[3]),
+			})
+			continue
+		}
+
+		if m := pytestBlockPattern.FindStringSubmatch(line); m != nil {
+			blocks[m[1]] = collectBlock(lines, i, func(l string) bool {
+				return pytestBlockPattern.MatchString(l) || pytestSectionPattern.MatchString(l)
+			})
+			continue
+		}
+
+		if m := pytestShortPattern.FindStringSubmatch(line); m != nil {
+			if j := findTest(r.Tests, m[2], m[3], "::"); j >= 0 {
+				if r.Tests[j].Message == "" {
+					r.Tests[j].Message = m[4]
+				}
+			} else {
+				r.Tests = append(r.Tests, utils.TestCase{
+					Name:    m[3],
+					Suite:   m[2],
+					Status:  utils.TestFailed,
+					Message: m[4],
+				})
+			}
+			continue
+		}
+
+		if m := pytestSummaryPattern.FindStringSubmatch(line); m != nil {
+			parseSummaryCounts(r, m[1])
+			r.DurationMs = secondsToMs(m[2])
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	// Failure sections are titled "test_name" or "TestClass.test_name"
+	for name, block := range blocks {
+		id := strings.ReplaceAll(name, ".", "::")
+		if j := findTest(r.Tests, "", id, "::"); j >= 0 && r.Tests[j].Status == utils.TestFailed {
+			r.Tests[j].Message = block
+		}
+	}
+
+	return r
+}
+
+func pytestStatus(s string) string {
+	switch s {
+	case "PASSED", "XPASS":
+		return utils.TestPassed
+	case "SKIPPED", "XFAIL":
+		return utils.TestSkipped
+	default:
+		return utils.TestFailed
+	}
+}
+
+// vitest
+
+var (
+	vitestDetectPattern   = regexp.MustCompile(`^\s*(Test Files\s+\d|RUN\s+v\d)`)
+	vitestFilePattern     = regexp.MustCompile(`^\s*[✓√×✗❯↓]\s+(\S+)\s+\(\d+ tests?[^)]*\)`)
+	vitestTestPattern     = regexp.MustCompile(`^\s*([✓√×✗↓])\s+(.+?)(?:\s+(\d+(?:\.\d+)?)ms)?$`)
+	vitestFailPattern     = regexp.MustCompile(`^\s*FAIL\s+(\S+) > (.+)$`)
+	vitestSummaryPattern  = regexp.MustCompile(`^\s*Tests\s+(.+?)\s+\(\d+\)\s*$`)
+	vitestDurationPattern = regexp.MustCompile(`^\s*Duration\s+([\d.]+)(ms|s)`)
+)
+
+func parseVitest(lines []string) *utils.TestResults {
+	found := false
+	for _, line := range lines {
+		if vitestDetectPattern.MatchString(line) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	r := &utils.TestResults{}
+	suite := ""
+
+	for i, line := range lines {
+		if m := vitestFilePattern.FindStringSubmatch(line); m != nil {
+			suite = m[1]
+			continue
+		}
+
+		if m := vitestFailPattern.FindStringSubmatch(line); m != nil {
+			message := collectBlock(lines, i, func(l string) bool {
+				return strings.HasPrefix(strings.TrimSpace(l), "⎯") || vitestFailPattern.MatchString(l)
+			})
+			if j := findTest(r.Tests, m[1], m[2], " > "); j >= 0 {
+				r.Tests[j].Status = utils.TestFailed
+				r.Tests[j].Message = message
+			} else {
+				r.Tests = append(r.Tests, utils.TestCase{
+					Name:    m[2],
+					Suite:   m[1],
+					Status:  utils.TestFailed,
+					Message: message,
+				})
+			}
+			continue
+		}
+
+		if m := vitestTestPattern.FindStringSubmatch(line); m != nil {
+			status := utils.TestPassed
+			switch m[1] {
+			case "×", "✗":
+				status = utils.TestFailed
+			case "↓":
+				status = utils.TestSkipped
+			}
+			r.Tests = append(r.Tests, utils.TestCase{
+				Name:       m[2],
+				Suite:      suite,
+				Status:     status,
+				DurationMs: durationToMs(m[3], "ms"),
+			})
+			continue
+		}
+
+		if m := vitestSummaryPattern.FindStringSubmatch(line); m != nil {
+			parseSummaryCounts(r, m[1])
+			continue
+		}
+
+		if m := vitestDurationPattern.FindStringSubmatch(line); m != nil {
+			r.DurationMs = durationToMs(m[1], m[2])
+		}
+	}
+
+	return r
+}
+
+// jest
+
+var (
+	jestSuitePattern    = regexp.MustCompile(`^(PASS|FAIL)\s+(\S+)`)
+	jestTestPattern     = regexp.MustCompile(`^\s+([✓√✕×○✎])\s+(?:(?:skipped|todo)\s+)?(.+?)(?:\s+\((\d+(?:\.\d+)?) ?(ms|s)\))?$`)
+	jestFailurePattern  = regexp.MustCompile(`^\s+● (.+)$`)
+	jestSummaryPattern  = regexp.MustCompile(`^Tests:\s+(.+?),?\s+\d+ total$`)
+	jestDurationPattern = regexp.MustCompile(`^Time:\s+([\d.]+)\s*(ms|s)`)
+)
+
+func parseJest(lines []string) *utils.TestResults {
+	r := &utils.TestResults{}
+	found := false
+	suite := ""
+
+	for i, line := range lines {
+		if m := jestSuitePattern.FindStringSubmatch(line); m != nil {
+			found = true
+			suite = m[2]
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		if m := jestFailurePattern.FindStringSubmatch(line); m != nil {
+			name := m[1]
+			message := collectBlock(lines, i, func(l string) bool {
+				return jestFailurePattern.MatchString(l) || jestSuitePattern.MatchString(l) ||
+					strings.HasPrefix(l, "Test Suites:") || strings.HasPrefix(l, "Summary of all failing tests")
+			})
+			if name == "Test suite failed to run" {
+				name = "(suite)"
+			}
+			if j := findTest(r.Tests, suite, name, " › "); j >= 0 {
+				r.Tests[j].Status = utils.TestFailed
+				r.Tests[j].Message = message
+			} else {
+				r.Tests = append(r.Tests, utils.TestCase{
+					Name:    name,
+					Suite:   suite,
+					Status:  utils.TestFailed,
+					Message: message,
+				})
+			}
+			continue
+		}
+
+		if m := jestTestPattern.FindStringSubmatch(line); m != nil {
+			status := utils.TestPassed
+			switch m[1] {
+			case "✕", "×":
+				status = utils.TestFailed
+			case "○", "✎":
+				status = utils.TestSkipped
+			}
+			r.Tests = append(r.Tests, utils.TestCase{
+				Name:       m[2],
+				Suite:      suite,
+				Status:     status,
+				DurationMs: durationToMs(m[3], m[4]),
+			})
+			continue
+		}
+
+		if m := jestSummaryPattern.FindStringSubmatch(line); m != nil {
+			parseSummaryCounts(r, m[1])
+			continue
+		}
+
+		if m := jestDurationPattern.FindStringSubmatch(line); m != nil {
+			r.DurationMs = durationToMs(m[1], m[2])
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,38 @@
+package run
+
+import (
+	"io"
+	"time"
+)
+
+// lineTimestampWriter records the time each output line started.
+// It writes one RFC 3339 timestamp per log line into a sidecar file
+// (stdout.timestamps / stderr.timestamps) so log lines can be dated
+// later without changing the log format itself.
+type lineTimestampWriter struct {
+	out         io.Writer
+	atLineStart bool
+}
+
+func newLineTimestampWriter(out io.Writer) *lineTimestampWriter {
+	return &lineTimestampWriter{out: out, atLineStart: true}
+}
+
+func (w *lineTimestampWriter) Write(p []byte) (int, error) {
+	var stamp []byte
+	for _, b := range p {
+		if w.atLineStart {
+			if stamp == nil {
+				stamp = []byte(time.Now().Format(time.RFC3339Nano) + "\n")
+			}
+			// Timestamps are best effort and must never interrupt the
+			// command's real output, so write errors are ignored.
+			w.out.Write(stamp)
+			w.atLineStart = false
+		}
+		if b == '\n' {
+			w.atLineStart = true
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuditLogName is the audit log file inside the .dkit directory
+const AuditLogName = "audit.jsonl"
+
+// AuditOutcome classifies an audited tool call
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditError   AuditOutcome = "error"
+	AuditDenied  AuditOutcome = "denied"
+)
+
+// AuditClient identifies the MCP client that made a call
+type AuditClient struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// AuditRecord is a single line of the audit log
+type AuditRecord struct {
+	Timestamp  time.Time              `json:"timestamp"`
+	Client     *AuditClient           `json:"client,omitempty"`
+	Tool       string                 `json:"tool"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Outcome    AuditOutcome           `json:"outcome"`
+	Result     string                 `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// AppendAuditRecord appends a record to .dkit/audit.jsonl
+func AppendAuditRecord(projectRoot string, record AuditRecord) error {
+	dataDir, err := EnsureDkitDataDir(projectRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create .dkit directory: %w", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dataDir, AuditLogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	// A single write keeps concurrent appends from interleaving
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// LoadAuditRecords reads all records from .dkit/audit.jsonl, oldest first.
+// Malformed lines (e.g. from an interrupted write) are skipped.
+func LoadAuditRecords(projectRoot string) ([]AuditRecord, error) {
+	dataDir, err := GetDkitDataDir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(dataDir, AuditLogName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	records := []AuditRecord{}
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record AuditRecord
+			if err := json.Unmarshal(line, &record); err == nil {
+				records = append(records, record)
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around changes
+const diffContextLines = 3
+
+// diffLine is a line of a line-based diff: ' ' unchanged, '-' removed,
+// '+' added
+type diffLine struct {
+	op      byte
+	text    string
+	oldLine int
+	newLine int
+}
+
+// UnifiedDiff returns a unified diff between two texts, or an empty string
+// if they are equal
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	lines := diffLines(splitDiffLines(oldText), splitDiffLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(lines); {
+		// Find the next change
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		from := max(start-diffContextLines, 0)
+		end := start
+		for i := start; i < len(lines); i++ {
+			if lines[i].op != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContextLines {
+				break
+			}
+		}
+		to := min(end+diffContextLines, len(lines))
+
+		oldStart, newStart := lines[from].oldLine, lines[from].newLine
+		oldCount, newCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(&b, "%c%s\n", l.op, l.text)
+		}
+
+		start = to
+	}
+
+	return b.String()
+}
+
+// splitDiffLines splits text into lines without the final newline
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line diff. The common prefix and suffix are matched
+// directly so that only the changed region needs the quadratic LCS table.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	// lcs[i][j] is the LCS length of midA[i:] and midB[j:]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	result := []diffLine{}
+	oldLine, newLine := 1, 1
+	add := func(op byte, text string) {
+		result = append(result, diffLine{op: op, text: text, oldLine: oldLine, newLine: newLine})
+		if op != '+' {
+			oldLine++
+		}
+		if op != '-' {
+			newLine++
+		}
+	}
+
+	for _, line := range a[:prefix] {
+		add(' ', line)
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			add(' ', midA[i])
+			i++
+			j++
+		case i < len(midA) && (j == len(midB) || lcs[i+1][j] >= lcs[i][j+1]):
+			add('-', midA[i])
+			i++
+		default:
+			add('+', midB[j])
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		add(' ', line)
+	}
+
+	return result
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const (
+	// BytesPerToken approximates how many bytes of log text make up a token
+	BytesPerToken = 4
+
+	// excerptMarkerBytes is reserved for each elision marker
+	excerptMarkerBytes = 100
+
+	// minExcerptLineBytes is the shortest a long line is cut to
+	minExcerptLineBytes = 80
+)
+
+// ErrorLinePattern matches log lines that look like errors
+var ErrorLinePattern = regexp.MustCompile(`(?i)\b(error|errors|fail|failed|failure|fatal|panic|panicked|exception|traceback|assert(ion)?|undefined reference|segmentation fault|denied|refused|timed? ?out)\b|✕|×|✗`)
+
+// ExcerptOptions controls how a log is shortened to fit a budget
+type ExcerptOptions struct {
+	// MaxBytes is the budget for the excerpt, markers included. Zero means
+	// no limit.
+	MaxBytes int
+
+	// HeadLines and TailLines are the most lines kept from the start and
+	// end of the log
+	HeadLines int
+	TailLines int
+
+	// Context is the number of lines kept around each error-like line
+	Context int
+
+	// Pattern matches error-like lines (default ErrorLinePattern)
+	Pattern *regexp.Regexp
+
+	// FirstLine is the 1-based line number of the first line passed in
+	FirstLine int
+
+	// Marker describes omitted lines from..to (1-based, inclusive),
+	// e.g. with instructions for fetching them
+	Marker func(from, to int) string
+}
+
+// Excerpt is a log shortened to fit a budget. Lines contains the kept log
+// lines with elision markers in place of the omitted ones.
+type Excerpt struct {
+	Lines        []string `json:"lines"`
+	TotalLines   int      `json:"total_lines"`
+	ShownLines   int      `json:"shown_lines"`
+	OmittedLines int      `json:"omitted_lines"`
+	ErrorLines   int      `json:"error_lines"`
+}
+
+// BuildExcerpt keeps the lines of a log that matter most within the
+// budget: the end of the log, error-like lines, the start of the log and
+// the context around errors, in that order of priority
+func BuildExcerpt(lines []string, opts ExcerptOptions) *Excerpt {
+	if opts.HeadLines == 0 {
+		opts.HeadLines = 20
+	}
+	if opts.TailLines == 0 {
+		opts.TailLines = 50
+	}
+	if opts.Context == 0 {
+		opts.Context = 2
+	}
+	if opts.Pattern == nil {
+		opts.Pattern = ErrorLinePattern
+	}
+	if opts.FirstLine == 0 {
+		opts.FirstLine = 1
+	}
+	if opts.Marker == nil {
+		opts.Marker = func(from, to int) string {
+			return fmt.Sprintf("[dkit] ... %d lines omitted (%d-%d) ...", to-from+1, from, to)
+		}
+	}
+
+	excerpt := &Excerpt{TotalLines: len(lines), Lines: []string{}}
+
+	errorLines := []int{}
+	for i, line := range lines {
+		if opts.Pattern.MatchString(line) {
+			errorLines = append(errorLines, i)
+		}
+	}
+	excerpt.ErrorLines = len(errorLines)
+
+	total := 0
+	for _, line := range lines {
+		total += len(line) + 1
+	}
+	if opts.MaxBytes <= 0 || total <= opts.MaxBytes {
+		excerpt.Lines = append([]string{}, lines...)
+		excerpt.ShownLines = len(lines)
+		return excerpt
+	}
+
+	// Cut very long lines (minified output, progress bars) so a single
+	// line cannot consume the whole budget
+	maxLine := opts.MaxBytes / 8
+	if maxLine < minExcerptLineBytes {
+		maxLine = minExcerptLineBytes
+	}
+	shorten := func(line string) string {
+		if len(line) <= maxLine {
+			return line
+		}
+		return fmt.Sprintf("%s ... (+%d bytes)", line[:maxLine], len(line)-maxLine)
+	}
+
+	// Candidate lines in order of priority
+	candidates := []int{}
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-10; i-- {
+		candidates = append(candidates, i)
+	}
+	candidates = append(candidates, errorLines...)
+	for i := 0; i < len(lines) && i < 5; i++ {
+		candidates = append(candidates, i)
+	}
+	for _, e := range errorLines {
+		for d := 1; d <= opts.Context; d++ {
+			candidates = append(candidates, e-d, e+d)
+		}
+	}
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-opts.TailLines; i-- {
+		candidates = append(candidates, i)
+	}
+	for i := 0; i < len(lines) && i < opts.HeadLines; i++ {
+		candidates = append(candidates, i)
+	}
+
+	selected := map[int]bool{}
+	used := excerptMarkerBytes // a marker is always needed somewhere
+	for _, i := range candidates {
+		if i < 0 || i >= len(lines) || selected[i] {
+			continue
+		}
+		cost := len(shorten(lines[i])) + 1
+		if !selected[i-1] && !selected[i+1] {
+			// May open a new gap that needs its own marker
+			cost += excerptMarkerBytes
+		}
+		if used+cost > opts.MaxBytes {
+			continue
+		}
+		selected[i] = true
+		used += cost
+	}
+
+	indices := make([]int, 0, len(selected))
+	for i := range selected {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	next := 0
+	for _, i := range indices {
+		if i > next {
+			excerpt.Lines = append(excerpt.Lines, opts.Marker(opts.FirstLine+next, opts.FirstLine+i-1))
+			excerpt.OmittedLines += i - next
+		}
+		excerpt.Lines = append(excerpt.Lines, shorten(lines[i]))
+		next = i + 1
+	}
+	if next < len(lines) {
+		excerpt.Lines = append(excerpt.Lines, opts.Marker(opts.FirstLine+next, opts.FirstLine+len(lines)-1))
+		excerpt.OmittedLines += len(lines) - next
+	}
+	excerpt.ShownLines = len(indices)
+
+	return excerpt
+}
+
+// SplitExcerptBudget divides a byte budget between logs of the given sizes.
+// A log that needs less than its share leaves the rest to the others. A
+// zero budget means no limit.
+func SplitExcerptBudget(sizes []int, maxBytes int) []int {
+	budgets := make([]int, len(sizes))
+	if maxBytes <= 0 {
+		return budgets
+	}
+
+	remaining := maxBytes
+	pending := make([]int, len(sizes))
+	for i := range sizes {
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		share := remaining / len(pending)
+		next := []int{}
+		for _, i := range pending {
+			if sizes[i] <= share {
+				budgets[i] = sizes[i]
+				remaining -= sizes[i]
+			} else {
+				next = append(next, i)
+			}
+		}
+		if len(next) == len(pending) {
+			for _, i := range next {
+				budgets[i] = share
+			}
+			break
+		}
+		pending = next
+	}
+
+	// Keep every budget limited; zero would mean unlimited
+	for i := range budgets {
+		if budgets[i] == 0 {
+			budgets[i] = 1
+		}
+	}
+	return budgets
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// InputFIFOName is the name of the input FIFO inside a process directory
+const InputFIFOName = "stdin.fifo"
+
+// InputLogName is the name of the log recording every input sent to a process
+const InputLogName = "input.log"
+
+// inputWriteTimeout bounds how long a sender waits for a process that
+// does not read its input
+const inputWriteTimeout = 10 * time.Second
+
+// inputWriteMu keeps concurrent messages from interleaving in the FIFO;
+// writes larger than the pipe buffer are not atomic
+var inputWriteMu sync.Mutex
+
+// ProcessInput is a single message written to a process's input FIFO.
+// Messages are newline-delimited JSON so that text, signals and EOF can
+// share one channel.
+type ProcessInput struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source,omitempty"`
+	Data   string    `json:"data,omitempty"`
+	Signal string    `json:"signal,omitempty"`
+	EOF    bool      `json:"eof,omitempty"`
+}
+
+// SendProcessInput writes an input message to a process's input FIFO.
+// It fails instead of blocking when no process is reading the FIFO, and
+// when the process stops draining it for longer than inputWriteTimeout.
+func SendProcessInput(fifoPath string, input ProcessInput) error {
+	if input.Time.IsZero() {
+		input.Time = time.Now()
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode input: %w", err)
+	}
+	data = append(data, '\n')
+
+	file, err := openInputFIFOForWriting(fifoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	inputWriteMu.Lock()
+	defer inputWriteMu.Unlock()
+
+	// The FIFO is non-blocking, so large messages are written in parts as
+	// the process drains it; the deadline stops waiting for a stuck reader
+	file.SetWriteDeadline(time.Now().Add(inputWriteTimeout))
+	if _, err := file.Write(data); err != nil {
+		if os.IsTimeout(err) {
+			return fmt.Errorf("process is not reading its input")
+		}
+		return fmt.Errorf("failed to write input: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// CreateInputFIFO creates a named pipe used to send input to a process
+func CreateInputFIFO(path string) error {
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return fmt.Errorf("failed to create input FIFO: %w", err)
+	}
+	return nil
+}
+
+// OpenInputFIFO opens the input FIFO for reading. It is opened read-write
+// so that reads block while no writer is connected instead of hitting EOF
+// every time a sender closes its end.
+func OpenInputFIFO(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input FIFO: %w", err)
+	}
+	return file, nil
+}
+
+func openInputFIFOForWriting(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ENXIO) {
+			return nil, fmt.Errorf("process is not accepting input")
+		}
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("process has no input channel (start it with dkit run --input-fifo)")
+		}
+		return nil, fmt.Errorf("failed to open input FIFO: %w", err)
+	}
+	return file, nil
+}
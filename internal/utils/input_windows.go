@@ -0,0 +1,22 @@
+//go:build windows
+
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// CreateInputFIFO creates a named pipe used to send input to a process
+func CreateInputFIFO(path string) error {
+	return fmt.Errorf("input FIFOs are not supported on Windows")
+}
+
+// OpenInputFIFO opens the input FIFO for reading
+func OpenInputFIFO(path string) (*os.File, error) {
+	return nil, fmt.Errorf("input FIFOs are not supported on Windows")
+}
+
+func openInputFIFOForWriting(path string) (*os.File, error) {
+	return nil, fmt.Errorf("input FIFOs are not supported on Windows")
+}
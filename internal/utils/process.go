@@ -17,6 +17,10 @@ const (
 	StatusFailed    ProcessStatus = "failed"
 )
 
+// ProcessKindRetry marks a dkit retry session. Processes started by dkit run
+// have no kind.
+const ProcessKindRetry = "retry"
+
 // ProcessMetadata contains metadata about a running or completed process
 type ProcessMetadata struct {
 	ID         string        `json:"id"`
@@ -30,6 +34,28 @@ type ProcessMetadata struct {
 	ExitCode   *int          `json:"exit_code,omitempty"`
 	StdoutPath string        `json:"stdout_path"`
 	StderrPath string        `json:"stderr_path"`
+	InputPath  string        `json:"input_path,omitempty"`
+
+	// Kind and Attempts describe retry sessions, whose logs combine the
+	// output of every attempt
+	Kind     string           `json:"kind,omitempty"`
+	Attempts []ProcessAttempt `json:"attempts,omitempty"`
+}
+
+// ProcessAttempt is a single attempt of a retry session
+type ProcessAttempt struct {
+	Attempt       int        `json:"attempt"`
+	PID           int        `json:"pid,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	DurationMs    int64      `json:"duration_ms"`
+	ExitCode      *int       `json:"exit_code,omitempty"`
+	TimedOut      bool       `json:"timed_out,omitempty"`
+	Cancelled     bool       `json:"cancelled,omitempty"`      // a hedged copy stopped after another won
+	FailureReason string     `json:"failure_reason,omitempty"` // why a failed attempt failed
+	DelayMs       int64      `json:"delay_ms,omitempty"`       // wait before the next attempt
+	StdoutPath    string     `json:"stdout_path"`
+	StderrPath    string     `json:"stderr_path"`
 }
 
 // ProcessRegistry manages the index of all processes
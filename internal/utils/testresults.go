@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TestResultsName is the test results file inside a process directory
+const TestResultsName = "tests.json"
+
+// Test case statuses
+const (
+	TestPassed  = "passed"
+	TestFailed  = "failed"
+	TestSkipped = "skipped"
+)
+
+// TestResults summarizes the tests reported by a test framework run
+type TestResults struct {
+	Framework  string     `json:"framework"`
+	Passed     int        `json:"passed"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Tests      []TestCase `json:"tests"`
+}
+
+// TestCase is a single test reported by a test framework
+type TestCase struct {
+	Name       string `json:"name"`
+	Suite      string `json:"suite,omitempty"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// FailedTests returns the failed test cases
+func (r *TestResults) FailedTests() []TestCase {
+	failed := []TestCase{}
+	for _, t := range r.Tests {
+		if t.Status == TestFailed {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// SaveTestResults writes tests.json to the process directory
+func SaveTestResults(projectRoot, processID string, results *TestResults) error {
+	dataDir, err := GetDkitDataDir(projectRoot)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal test results: %w", err)
+	}
+
+	path := filepath.Join(dataDir, "processes", processID, TestResultsName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write test results: %w", err)
+	}
+
+	return nil
+}
+
+// LoadTestResults reads tests.json from the process directory. It returns
+// nil without an error if the run produced no test results.
+func LoadTestResults(projectRoot, processID string) (*TestResults, error) {
+	dataDir, err := GetDkitDataDir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "processes", processID, TestResultsName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read test results: %w", err)
+	}
+
+	var results TestResults
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse test results: %w", err)
+	}
+
+	return &results, nil
+}